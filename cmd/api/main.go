@@ -2,15 +2,31 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 	"wb-tech-test/internal/api"
+	"wb-tech-test/internal/archive"
 	"wb-tech-test/internal/cache"
 	"wb-tech-test/internal/db"
+	"wb-tech-test/internal/db/sqlite"
 	"wb-tech-test/internal/kafka"
+	"wb-tech-test/internal/validation"
 
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	partitionMonthsAhead = 3                // количество месяцев вперед, на которые заранее создаются партиции таблиц заказов
+	shutdownTimeout      = 15 * time.Second // время на завершение запросов и обработку сообщений при остановке
 )
 
 func main() {
@@ -19,40 +35,185 @@ func main() {
 		log.Fatalf("[MAIN] Ошибка при загрузке файла .env для API: %v", err)
 	}
 
-	ctx := context.Background() // создаем новый контекст
+	// контекст отменяется по SIGINT/SIGTERM, после чего сервис завершает работу
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	database := db.NewDB()              // создаем новый пул соединений с БД
-	defer database.Pool.Close()         // закрываем пул соединений с БД
+	store := openStore()                // открываем хранилище заказов (Postgres или SQLite), закрывается после остановки консьюмера
 	orderCache := cache.NewOrderCache() // создаем новый кэш
 
+	// фоновые задачи Postgres: партиции, реплики и архивация
+	database, isPostgres := store.(*db.DB)
+	if isPostgres {
+		startPostgresJobs(ctx, database)
+	}
+
 	// восстанавливаем кэш из БД
-	if err := restoreCache(ctx, database, orderCache); err != nil {
+	if err := restoreCache(ctx, store, orderCache); err != nil {
 		log.Printf("[MAIN] Ошибка при восстановлении кэша: %v", err)
 	}
 
-	// проверяем, что топик в Kafka существует
-	err = kafka.EnsureTopicExists("wb-kafka:9092", "orders", 1)
+	// создаем валидатор заказов по встроенной JSON Schema (общий для API и консьюмера)
+	validator, err := validation.NewOrderValidator()
 	if err != nil {
-		log.Fatalf("[MAIN] Ошибка при создании топика: %v", err)
+		log.Fatalf("[MAIN] Ошибка при загрузке схемы заказа: %v", err)
+	}
+
+	// Создаём HTTP-сервер
+	Server := api.NewServer(store, orderCache)
+	Server.SetValidator(validator)
+
+	// метрики сервиса (Go runtime, процесс и консьюмер Kafka) публикуются на GET /metrics
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	Server.SetMetricsHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	// без Kafka заказы из POST /orders сохраняются напрямую, что позволяет запускать сервис одним процессом
+	var workers sync.WaitGroup // консьюмер и ретранслятор, которые нужно дождаться при остановке
+	if os.Getenv("KAFKA_ENABLED") == "false" {
+		log.Printf("[MAIN] Kafka отключена, заказы сохраняются напрямую")
+	} else {
+		// настройки Kafka проверяются до подключения, чтобы ошибка конфигурации была видна сразу
+		kafkaConfig, err := kafka.LoadConfig()
+		if err != nil {
+			log.Fatalf("[MAIN] Некорректные настройки Kafka: %v", err)
+		}
+		Server.SetKafkaWriter(kafkaConfig.NewWriter(kafkaConfig.Topic))
+		startKafka(ctx, kafkaConfig, &workers, store, database, orderCache, validator, registry)
+	}
+
+	port := getPort() // получаем порт из переменных окружения
+	go func() {
+		log.Printf("[MAIN] API server запущен на порту :%s\n", port)
+		if err := Server.Start(":" + port); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[MAIN] Ошибка при запуске HTTP-сервера: %v", err)
+			stop() // без HTTP-сервера продолжать работу нет смысла
+		}
+	}()
+
+	<-ctx.Done()
+	log.Printf("[MAIN] Получен сигнал остановки, завершаем работу")
+
+	// сначала перестаем принимать HTTP-запросы, затем дожидаемся обработки сообщений из Kafka
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := Server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("[MAIN] Ошибка при остановке HTTP-сервера: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		store.Close() // закрываем соединения с БД только после завершения консьюмера и ретранслятора
+		log.Printf("[MAIN] Сервис остановлен")
+	case <-shutdownCtx.Done():
+		// соединения с БД не закрываются: незавершенная обработка прервется вместе с процессом,
+		// а незафиксированные транзакции откатятся, и сообщения будут обработаны повторно
+		log.Printf("[MAIN] Обработка сообщений не завершилась за %s, завершаем работу без закрытия соединений с БД", shutdownTimeout)
+	}
+}
+
+// функция для открытия хранилища заказов, выбранного переменной окружения DB_DRIVER
+// возвращаемое значение: Postgres (по умолчанию) или SQLite (DB_DRIVER=sqlite, путь к файлу в SQLITE_PATH)
+func openStore() db.OrderStore {
+	if os.Getenv("DB_DRIVER") != "sqlite" {
+		return db.NewDB() // создаем новый пул соединений с БД
+	}
+
+	path := os.Getenv("SQLITE_PATH")
+	if path == "" {
+		path = "orders.db"
+	}
+	store, err := sqlite.NewDB(path)
+	if err != nil {
+		log.Fatalf("[MAIN] Ошибка при открытии SQLite: %v", err)
+	}
+	return store
+}
+
+// функция для запуска фоновых задач Postgres: создания партиций, проверки реплик и архивации
+func startPostgresJobs(ctx context.Context, database *db.DB) {
+	// создаем месячные партиции таблиц заказов до начала записи,
+	// чтобы новые заказы не попадали в партиции по умолчанию
+	if err := database.EnsurePartitions(ctx, time.Now(), partitionMonthsAhead); err != nil {
+		log.Printf("[MAIN] Ошибка при создании партиций: %v", err)
+	}
+	go database.RunPartitionMaintenance(ctx, 24*time.Hour, partitionMonthsAhead)
+	go database.RunReplicaHealthCheck(ctx, 5*time.Second) // проверяем доступность реплик для чтения
+
+	// запускаем архивацию старых заказов, если задан каталог архива
+	if dir := os.Getenv("ARCHIVE_DIR"); dir != "" {
+		archiver, err := archive.NewArchiver(dir, getDuration("ARCHIVE_MAX_AGE", 365*24*time.Hour), database)
+		if err != nil {
+			log.Fatalf("[MAIN] Ошибка при создании архиватора: %v", err)
+		}
+		if os.Getenv("ARCHIVE_LOOKUP") == "true" {
+			database.SetArchive(archiver) // заказы, которых нет в БД, ищем в архиве
+		}
+		go archiver.Run(ctx, getDuration("ARCHIVE_INTERVAL", time.Hour))
+	}
+}
+
+// функция для подготовки Kafka и запуска консьюмера заказов и ретранслятора outbox
+// консьюмер и ретранслятор работают до отмены контекста и закрываются после остановки, workers отслеживает их завершение
+func startKafka(ctx context.Context, kafkaConfig kafka.Config, workers *sync.WaitGroup, store db.OrderStore, database *db.DB, orderCache *cache.OrderCache, validator *validation.OrderValidator, registry prometheus.Registerer) {
+	// проверяем, что топики заказов, событий и необработанных сообщений в Kafka существуют
+	dialer := kafkaConfig.Dialer()
+	for _, topic := range []string{kafkaConfig.Topic, kafkaConfig.EventsTopic, kafkaConfig.DeadLetterTopic} {
+		if err := kafka.EnsureTopicExists(dialer, kafkaConfig.Brokers, topic, kafkaConfig.TopicPartitions); err != nil {
+			log.Fatalf("[MAIN] Ошибка при создании топика %s: %v", topic, err)
+		}
 	}
 
 	// ожидаем доступности Kafka
-	if err := kafka.WaitForKafka([]string{"wb-kafka:9092"}, "orders", 10, 5*time.Second); err != nil {
+	if err := kafka.WaitForKafka(dialer, kafkaConfig.Brokers, kafkaConfig.Topic, 10, 5*time.Second); err != nil {
 		log.Fatalf("[MAIN] Kafka недоступна: %v", err)
 	}
 
 	// создаем и запускаем нового консьюмера
-	consumer := kafka.NewConsumer([]string{"wb-kafka:9092"}, "orders", database, orderCache)
-	go consumer.Consume()
+	consumer := kafka.NewConsumer(kafkaConfig, store, orderCache)
+	consumer.DeadLetter = kafka.NewDeadLetterPublisher(kafkaConfig)
+	consumer.Validator = validator
 
-	// Создаём и запускаем HTTP-сервер
-	Server := api.NewServer(database, orderCache)
+	// декодеры JSON, Protobuf и Avro; Avro-схема заказа регистрируется в локальном реестре схем
+	schemaRegistry := kafka.NewSchemaRegistry()
+	schemaID, err := schemaRegistry.Register(kafka.OrderSubject, kafka.OrderAvroSchema)
+	if err != nil {
+		log.Fatalf("[MAIN] Ошибка при регистрации Avro-схемы заказа: %v", err)
+	}
+	log.Printf("[MAIN] Avro-схема заказа зарегистрирована с идентификатором %d", schemaID)
+	consumer.Decoders = kafka.NewOrderDecoders(schemaRegistry)
 
-	port := getPort() // получаем порт из переменных окружения
-	if err := Server.Start(":" + port); err != nil {
-		log.Printf("[MAIN] Ошибка при запуске HTTP-сервера: %v", err)
+	// метрики отставания, скорости чтения, времени обработки и ошибок консьюмера
+	consumer.Metrics = kafka.NewMetrics(consumer)
+	registry.MustRegister(consumer.Metrics)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		if err := consumer.Run(ctx); err != nil {
+			log.Printf("[MAIN] Ошибка консьюмера: %v", err)
+		}
+		if err := consumer.Close(); err != nil {
+			log.Printf("[MAIN] Ошибка при закрытии консьюмера: %v", err)
+		}
+	}()
+
+	// создаем и запускаем ретранслятор событий из outbox в Kafka (outbox есть только в Postgres)
+	if database != nil {
+		relay := kafka.NewOutboxRelay(kafkaConfig, database)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			relay.Run(ctx)
+			if err := relay.Close(); err != nil {
+				log.Printf("[MAIN] Ошибка при закрытии ретранслятора outbox: %v", err)
+			}
+		}()
 	}
-	log.Printf("[MAIN] API server запущен на порту :%s\n", port)
 }
 
 // функция для получения порта из переменных окружения
@@ -64,10 +225,25 @@ func getPort() string {
 	return "8081"
 }
 
+// функция для получения длительности из переменной окружения
+// возвращаемое значение: длительность из переменной окружения или значение по умолчанию, если переменная не задана или некорректна
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("[MAIN] Некорректное значение %s=%q, используется %s", key, value, fallback)
+		return fallback
+	}
+	return duration
+}
+
 // функция для восстановления кэша из БД
 // возвращаемое значение: ошибка, если кэш не восстановлен
-func restoreCache(ctx context.Context, database *db.DB, orderCache *cache.OrderCache) error {
-	orders, err := database.GetAllOrders(ctx) // получаем все заказы из БД
+func restoreCache(ctx context.Context, store db.OrderStore, orderCache *cache.OrderCache) error {
+	orders, err := store.GetAllOrders(ctx) // получаем все заказы из БД
 	if err != nil {
 		log.Printf("[MAIN] Ошибка при получении всех заказов для загрузки в кэш: %v", err)
 		return err
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+	"wb-tech-test/internal/db"
+)
+
+// утилита для проверки целостности заказов в БД
+// находит заказы без delivery/payment/items, строки без заказа и расхождения сумм,
+// печатает отчет и по флагам переносит неполные заказы в карантин или исправляет goods_total
+func main() {
+	quarantine := flag.Bool("quarantine", false, "перенести неполные заказы и строки без заказа в таблицу quarantine")
+	repair := flag.Bool("repair", false, "исправить goods_total по сумме total_price товаров")
+	flag.Parse()
+
+	ctx := context.Background() // создаем новый контекст
+
+	database := db.NewDB() // создаем новый пул соединений с БД
+	defer database.Close() // закрываем пулы соединений с БД
+
+	issues, err := database.CheckConsistency(ctx)
+	if err != nil {
+		log.Fatalf("[CHECKER] Ошибка проверки целостности: %v", err)
+	}
+
+	printReport(issues)
+	if len(issues) == 0 {
+		return
+	}
+
+	failed := 0
+	for _, issue := range issues {
+		switch {
+		case *quarantine && isQuarantinable(issue):
+			if _, err := database.QuarantineOrder(ctx, issue); err != nil {
+				failed++
+			}
+		case *repair && issue.Kind == db.IssueGoodsTotalMismatch:
+			if err := database.RepairGoodsTotal(ctx, issue); err != nil {
+				failed++
+			}
+		}
+	}
+
+	if failed > 0 {
+		log.Printf("[CHECKER] Не удалось исправить нарушений: %d", failed)
+	}
+	if !*quarantine && !*repair {
+		os.Exit(1) // нарушения найдены, но не исправлялись
+	}
+}
+
+// функция для печати отчета о найденных нарушениях
+func printReport(issues []db.Issue) {
+	if len(issues) == 0 {
+		fmt.Println("Нарушений целостности не найдено")
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, issue := range issues {
+		counts[issue.Kind]++
+		fmt.Printf("%-22s %-30s %s %s\n", issue.Kind, issue.OrderUID, issue.DateCreated.UTC().Format(time.RFC3339), issue.Details)
+	}
+
+	fmt.Println()
+	fmt.Printf("Всего нарушений: %d\n", len(issues))
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Printf("  %s: %d\n", kind, counts[kind])
+	}
+}
+
+// функция для проверки, переносится ли заказ с таким нарушением в карантин
+// возвращаемое значение: true для неполных заказов и строк без заказа
+func isQuarantinable(issue db.Issue) bool {
+	switch issue.Kind {
+	case db.IssueMissingDelivery, db.IssueMissingPayment, db.IssueMissingItems,
+		db.IssueOrphanDelivery, db.IssueOrphanPayment, db.IssueOrphanItems:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"wb-tech-test/internal/cache"
+	"wb-tech-test/internal/db"
+	"wb-tech-test/internal/kafka"
+	"wb-tech-test/internal/model"
+	"wb-tech-test/internal/validation"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// утилита для повторной обработки сообщений топика заказов
+// читает партиции с указанного смещения или момента времени, фильтрует сообщения по ключу
+// и сохраняет заказы вместе с исходными сообщениями так же, как консьюмер (Consumer.ProcessOrder), не меняя его смещений;
+// в режиме -dry-run только сообщает, какие заказы были бы сохранены, а какие уже есть в БД
+func main() {
+	partition := flag.Int("partition", -1, "номер партиции (-1 - все партиции топика)")
+	fromOffset := flag.Int64("from-offset", -1, "смещение, с которого читается партиция")
+	fromTime := flag.String("from-time", "", "время в формате RFC3339, с которого читается партиция")
+	toOffset := flag.Int64("to-offset", -1, "последнее смещение, которое читается включительно (-1 - до конца партиции)")
+	toTime := flag.String("to-time", "", "время в формате RFC3339, после которого чтение останавливается")
+	key := flag.String("key", "", "обрабатывать только сообщения с указанным ключом (order_uid)")
+	dryRun := flag.Bool("dry-run", false, "не сохранять заказы, а только показать, что было бы сохранено")
+	flag.Parse()
+
+	opts, err := parseOptions(*partition, *fromOffset, *fromTime, *toOffset, *toTime, *key, *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[REPLAY] %v\n", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// чтение и сохранение прерываются по SIGINT/SIGTERM, итог печатается по уже обработанным сообщениям
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	database := db.NewDB() // создаем новый пул соединений с БД
+	defer database.Close() // закрываем пулы соединений с БД
+
+	kafkaConfig, err := kafka.LoadConfig()
+	if err != nil {
+		log.Fatalf("[REPLAY] Некорректные настройки Kafka: %v", err)
+	}
+	consumer, err := newConsumer(kafkaConfig, database)
+	if err != nil {
+		log.Fatalf("[REPLAY] Ошибка при создании консьюмера: %v", err)
+	}
+
+	partitions := []int{opts.partition}
+	if opts.partition < 0 {
+		partitions, err = kafkaConfig.Partitions()
+		if err != nil {
+			log.Fatalf("[REPLAY] Ошибка при получении партиций топика %s: %v", kafkaConfig.Topic, err)
+		}
+	}
+
+	replay := newReplayer(consumer, opts.dryRun)
+	var total report
+	for _, p := range partitions {
+		if ctx.Err() != nil {
+			break
+		}
+		r, err := replay.partition(ctx, kafkaConfig, p, opts)
+		if err != nil {
+			log.Printf("[REPLAY] Ошибка при чтении партиции %d: %v", p, err)
+			r.errors++
+		}
+		total.add(r)
+	}
+
+	total.print(opts.dryRun)
+	if total.errors > 0 {
+		os.Exit(1)
+	}
+}
+
+// структура параметров повторной обработки
+type options struct {
+	partition  int
+	fromOffset int64
+	fromTime   time.Time
+	toOffset   int64
+	toTime     time.Time
+	key        string
+	dryRun     bool
+}
+
+// функция для проверки флагов командной строки
+// возвращаемое значение: параметры обработки и ошибка, если флаги заданы некорректно
+func parseOptions(partition int, fromOffset int64, fromTime string, toOffset int64, toTime, key string, dryRun bool) (options, error) {
+	opts := options{partition: partition, fromOffset: fromOffset, toOffset: toOffset, key: key, dryRun: dryRun}
+
+	if (fromOffset >= 0) == (fromTime != "") {
+		return opts, errors.New("нужно указать ровно один из флагов -from-offset и -from-time")
+	}
+	if fromOffset >= 0 && partition < 0 {
+		return opts, errors.New("флаг -from-offset требует указать партицию (-partition)")
+	}
+	if fromTime != "" {
+		t, err := time.Parse(time.RFC3339, fromTime)
+		if err != nil {
+			return opts, fmt.Errorf("некорректное значение -from-time: %w", err)
+		}
+		opts.fromTime = t
+	}
+	if toTime != "" {
+		t, err := time.Parse(time.RFC3339, toTime)
+		if err != nil {
+			return opts, fmt.Errorf("некорректное значение -to-time: %w", err)
+		}
+		opts.toTime = t
+	}
+	if toOffset >= 0 && fromOffset >= 0 && toOffset < fromOffset {
+		return opts, errors.New("значение -to-offset меньше -from-offset")
+	}
+	return opts, nil
+}
+
+// функция для создания консьюмера с теми же валидатором и декодерами, что и в сервисе
+// кэш не используется утилитой, но нужен консьюмеру для сохранения заказа
+// возвращаемое значение: консьюмер и ошибка, если схемы не загружены
+func newConsumer(kafkaConfig kafka.Config, database *db.DB) (*kafka.Consumer, error) {
+	validator, err := validation.NewOrderValidator()
+	if err != nil {
+		return nil, err
+	}
+
+	schemaRegistry := kafka.NewSchemaRegistry()
+	if _, err := schemaRegistry.Register(kafka.OrderSubject, kafka.OrderAvroSchema); err != nil {
+		return nil, err
+	}
+
+	consumer := kafka.NewConsumer(kafkaConfig, database, cache.NewOrderCache())
+	consumer.Validator = validator
+	consumer.Decoders = kafka.NewOrderDecoders(schemaRegistry)
+	return consumer, nil
+}
+
+// структура повторной обработки сообщений
+// в пробном прогоне запоминает заказы, которые были бы сохранены, чтобы повторы в том же диапазоне считались конфликтами
+type replayer struct {
+	consumer     *kafka.Consumer
+	dryRun       bool
+	orders       map[string]string // order_uid -> позиция сообщения (партиция/смещение), которое сохранило бы заказ
+	transactions map[string]string // транзакция оплаты -> позиция сообщения
+}
+
+// функция для создания структуры повторной обработки сообщений
+func newReplayer(consumer *kafka.Consumer, dryRun bool) *replayer {
+	return &replayer{
+		consumer:     consumer,
+		dryRun:       dryRun,
+		orders:       make(map[string]string),
+		transactions: make(map[string]string),
+	}
+}
+
+// функция для повторной обработки сообщений одной партиции
+// возвращаемое значение: итог обработки партиции и ошибка, если партиция не прочитана
+func (rp *replayer) partition(ctx context.Context, kafkaConfig kafka.Config, partition int, opts options) (report, error) {
+	var r report
+
+	// конец партиции фиксируется до чтения, чтобы новые сообщения не продлевали обработку
+	end, err := kafkaConfig.LastOffset(ctx, partition)
+	if err != nil {
+		return r, err
+	}
+	if opts.toOffset >= 0 && opts.toOffset+1 < end {
+		end = opts.toOffset + 1
+	}
+
+	reader := kafkago.NewReader(kafkago.ReaderConfig{
+		Brokers:   kafkaConfig.Brokers,
+		Topic:     kafkaConfig.Topic,
+		Partition: partition,
+		Dialer:    kafkaConfig.Dialer(),
+		MinBytes:  kafkaConfig.MinBytes,
+		MaxBytes:  kafkaConfig.MaxBytes,
+		MaxWait:   kafkaConfig.MaxWait,
+	})
+	defer reader.Close()
+
+	if opts.fromTime.IsZero() {
+		err = reader.SetOffset(opts.fromOffset)
+	} else {
+		err = reader.SetOffsetAt(ctx, opts.fromTime)
+	}
+	if err != nil {
+		return r, err
+	}
+
+	start := reader.Offset()
+	if start < 0 || start >= end {
+		log.Printf("[REPLAY] Партиция %d: нет сообщений для обработки", partition)
+		return r, nil
+	}
+	log.Printf("[REPLAY] Партиция %d: обработка смещений %d-%d", partition, start, end-1)
+
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return r, nil // чтение прервано сигналом
+			}
+			return r, err
+		}
+		if !opts.toTime.IsZero() && msg.Time.After(opts.toTime) {
+			return r, nil
+		}
+
+		r.read++
+		if opts.key == "" || string(msg.Key) == opts.key {
+			r.matched++
+			r.addResult(rp.message(ctx, msg))
+		}
+
+		if msg.Offset >= end-1 {
+			return r, nil
+		}
+	}
+}
+
+// результаты обработки сообщения
+const (
+	resultInserted = "inserted" // заказ сохранен (или был бы сохранен в режиме -dry-run)
+	resultConflict = "conflict" // заказ или транзакция оплаты уже есть в БД
+	resultInvalid  = "invalid"  // сообщение не прошло валидацию или не декодировано
+	resultError    = "error"    // ошибка БД
+)
+
+// функция для повторной обработки одного сообщения
+// возвращаемое значение: результат обработки сообщения
+func (rp *replayer) message(ctx context.Context, msg kafkago.Message) string {
+	position := fmt.Sprintf("%d/%d", msg.Partition, msg.Offset)
+	prefix := fmt.Sprintf("[REPLAY] %s key=%s", position, msg.Key)
+
+	order, err := rp.consumer.DecodeMessage(msg)
+	if err != nil {
+		log.Printf("%s: сообщение некорректно: %v", prefix, err)
+		return resultInvalid
+	}
+
+	if rp.dryRun {
+		err = rp.check(ctx, order, position)
+	} else {
+		err = rp.consumer.ProcessOrder(ctx, order, msg)
+	}
+
+	switch {
+	case err == nil && rp.dryRun:
+		log.Printf("%s: заказ %s будет сохранен", prefix, order.OrderUID)
+		return resultInserted
+	case err == nil:
+		log.Printf("%s: заказ %s сохранен", prefix, order.OrderUID)
+		return resultInserted
+	case errors.Is(err, db.ErrOrderExists):
+		log.Printf("%s: конфликт, %v", prefix, err)
+		return resultConflict
+	default:
+		log.Printf("%s: ошибка при обработке заказа %s: %v", prefix, order.OrderUID, err)
+		return resultError
+	}
+}
+
+// функция для проверки заказа в пробном прогоне
+// заказ конфликтует, если он уже есть в БД или был бы сохранен более ранним сообщением этого прогона
+// возвращаемое значение: ошибка db.ErrOrderExists при конфликте либо ошибка проверки
+func (rp *replayer) check(ctx context.Context, order model.Order, position string) error {
+	if earlier, ok := rp.orders[order.OrderUID]; ok {
+		return fmt.Errorf("заказ %s будет сохранен сообщением %s: %w", order.OrderUID, earlier, db.ErrOrderExists)
+	}
+	if earlier, ok := rp.transactions[order.Payment.Transaction]; ok {
+		return fmt.Errorf("транзакция %s будет сохранена сообщением %s: %w", order.Payment.Transaction, earlier, db.ErrOrderExists)
+	}
+	if err := rp.consumer.CheckOrder(ctx, order); err != nil {
+		return err
+	}
+	rp.orders[order.OrderUID] = position
+	rp.transactions[order.Payment.Transaction] = position
+	return nil
+}
+
+// структура итога повторной обработки
+type report struct {
+	read      int // прочитано сообщений
+	matched   int // сообщений, подходящих под фильтр по ключу
+	inserted  int
+	conflicts int
+	invalid   int
+	errors    int
+}
+
+// функция для учета результата обработки сообщения
+func (r *report) addResult(result string) {
+	switch result {
+	case resultInserted:
+		r.inserted++
+	case resultConflict:
+		r.conflicts++
+	case resultInvalid:
+		r.invalid++
+	default:
+		r.errors++
+	}
+}
+
+// функция для суммирования итогов по партициям
+func (r *report) add(other report) {
+	r.read += other.read
+	r.matched += other.matched
+	r.inserted += other.inserted
+	r.conflicts += other.conflicts
+	r.invalid += other.invalid
+	r.errors += other.errors
+}
+
+// функция для печати итога повторной обработки
+func (r report) print(dryRun bool) {
+	inserted := "сохранено"
+	if dryRun {
+		inserted = "будет сохранено"
+	}
+	log.Printf("[REPLAY] Прочитано сообщений: %d, подходит под фильтр: %d", r.read, r.matched)
+	log.Printf("[REPLAY] Заказов %s: %d, конфликтов: %d, некорректных сообщений: %d, ошибок: %d",
+		inserted, r.inserted, r.conflicts, r.invalid, r.errors)
+}
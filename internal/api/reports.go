@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"wb-tech-test/internal/db"
+)
+
+// функция настройки маршрутов отчетов о выручке
+func (s *Server) setupReportRoutes() {
+	s.router.HandleFunc("/reports/revenue/brand", s.reportHandler("brand", s.database.RevenueByBrand)).Methods("GET")                         // выручка по брендам
+	s.router.HandleFunc("/reports/revenue/delivery-service", s.reportHandler("delivery", s.database.RevenueByDeliveryService)).Methods("GET") // выручка по службам доставки
+	s.router.HandleFunc("/reports/revenue/currency", s.reportHandler("currency", s.database.RevenueByCurrency)).Methods("GET")                // выручка по валютам
+	s.router.HandleFunc("/reports/revenue/period", s.revenueByPeriod).Methods("GET")                                                          // выручка по дням, неделям или месяцам
+}
+
+// функция для создания обработчика отчета о выручке с фильтрацией по диапазону дат
+// параметры запроса: from и to - границы диапазона дат создания заказов (YYYY-MM-DD или RFC3339)
+func (s *Server) reportHandler(name string, report func(ctx context.Context, from, to time.Time) ([]db.ReportRow, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := parseDateRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rows, err := report(r.Context(), from, to)
+		if err != nil {
+			log.Printf("[API] Ошибка построения отчета %s: %v", name, err)
+			http.Error(w, "report error", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(rows)
+	}
+}
+
+// функция для получения выручки по интервалам времени
+// параметры запроса: bucket - day, week или month (по умолчанию day), from и to - границы диапазона дат
+func (s *Server) revenueByPeriod(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bucket := r.URL.Query().Get("bucket")
+	if bucket == "" {
+		bucket = "day"
+	}
+
+	rows, err := s.database.RevenueByPeriod(r.Context(), from, to, bucket)
+	if errors.Is(err, db.ErrInvalidBucket) {
+		http.Error(w, "invalid bucket", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[API] Ошибка построения отчета по периодам: %v", err)
+		http.Error(w, "report error", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(rows)
+}
+
+// функция для получения диапазона дат из параметров запроса from и to
+// возвращаемое значение: границы диапазона (нулевые, если не заданы) и ошибка, если дата некорректна
+func parseDateRange(r *http.Request) (time.Time, time.Time, error) {
+	from, err := parseDate(r.URL.Query().Get("from"))
+	if err != nil {
+		return from, time.Time{}, errors.New("invalid from")
+	}
+	to, err := parseDate(r.URL.Query().Get("to"))
+	if err != nil {
+		return from, to, errors.New("invalid to")
+	}
+	return from, to, nil
+}
+
+// функция для разбора даты в формате YYYY-MM-DD или RFC3339
+// возвращаемое значение: дата (нулевая для пустой строки) и ошибка, если формат некорректен
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if date, err := time.Parse(time.DateOnly, value); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
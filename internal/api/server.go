@@ -2,57 +2,145 @@ package api
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"wb-tech-test/internal/cache"
 	"wb-tech-test/internal/db"
 	"wb-tech-test/internal/model"
+	"wb-tech-test/internal/validation"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
 	"github.com/segmentio/kafka-go"
 )
 
+const (
+	defaultSearchLimit = 20  // количество заказов в результате поиска по умолчанию
+	maxSearchLimit     = 100 // максимальное количество заказов в результате поиска
+)
+
 // структура HTTP-сервера
 type Server struct {
 	router      *mux.Router
-	database    *db.DB
+	store       db.OrderStore // хранилище заказов (Postgres или SQLite)
+	database    *db.DB        // Postgres (nil, если используется SQLite)
 	orderCache  *cache.OrderCache
-	kafkaWriter *kafka.Writer
+	kafkaWriter *kafka.Writer              // писатель в Kafka (nil, если Kafka отключена)
+	validator   *validation.OrderValidator // валидатор заказов по JSON Schema (nil - заказы не проверяются)
+	httpServer  *http.Server
 }
 
 // функция для создания нового экземпляра сервера
-func NewServer(database *db.DB, orderCache *cache.OrderCache) *Server {
-	kafkaWriter := kafka.NewWriter(kafka.WriterConfig{
-		Brokers: []string{"wb-kafka:9092"},
-		Topic:   "orders",
-	})
-
+// маршруты, требующие Postgres (поиск, исходные сообщения, отчеты), регистрируются только при работе с Postgres
+func NewServer(store db.OrderStore, orderCache *cache.OrderCache) *Server {
 	s := &Server{
-		router:      mux.NewRouter(),
-		database:    database,
-		orderCache:  orderCache,
-		kafkaWriter: kafkaWriter,
+		router:     mux.NewRouter(),
+		store:      store,
+		orderCache: orderCache,
+		httpServer: &http.Server{},
+	}
+	if database, ok := store.(*db.DB); ok {
+		s.database = database
 	}
 	s.setupRoutes() // настройка маршрутов
 	return s
 }
 
+// функция для включения отправки заказов из POST /orders в Kafka
+// без писателя заказы сохраняются сразу в хранилище и кэш, что используется для локального запуска без внешних сервисов
+func (s *Server) SetKafkaWriter(writer *kafka.Writer) {
+	s.kafkaWriter = writer
+}
+
+// функция для включения проверки заказов из POST /orders по JSON Schema
+// используется тот же валидатор, что и в консьюмере Kafka
+func (s *Server) SetValidator(validator *validation.OrderValidator) {
+	s.validator = validator
+}
+
+// функция для публикации метрик по маршруту GET /metrics
+func (s *Server) SetMetricsHandler(handler http.Handler) {
+	s.router.Handle("/metrics", handler).Methods("GET")
+}
+
 // функция настройки маршрутов
 func (s *Server) setupRoutes() {
-	s.router.HandleFunc("/order/{order_uid}", s.getOrderByUID).Methods("GET") // маршрут для получения заказа по его UID
-	s.router.HandleFunc("/orders", s.handleKafkaProduce).Methods("POST")      // маршрут для отправки заказа в Kafka (для тестирования)
+	s.router.HandleFunc("/order/{order_uid}", s.getOrderByUID).Methods("GET")                   // маршрут для получения заказа по его UID
+	s.router.HandleFunc("/orders", s.handleKafkaProduce).Methods("POST")                        // маршрут для отправки заказа в Kafka (для тестирования)
+	s.router.HandleFunc("/order/{order_uid}/status", s.transitionOrderStatus).Methods("POST")   // маршрут для смены статуса заказа
+	s.router.HandleFunc("/order/{order_uid}/status/history", s.getStatusHistory).Methods("GET") // маршрут для получения истории статусов заказа
+	if s.database == nil {
+		return
+	}
+	s.router.HandleFunc("/orders/search", s.searchOrders).Methods("GET")             // маршрут для поиска заказов по товарам
+	s.router.HandleFunc("/order/{order_uid}/source", s.getRawMessage).Methods("GET") // маршрут для получения исходного сообщения Kafka
+	s.setupReportRoutes()                                                            // маршруты отчетов о выручке
 }
 
 // функция для отправки заказа в Kafka (для тестирования)
 func (s *Server) handleKafkaProduce(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("[API] Ошибка при чтении тела запроса: %v", err)
+		http.Error(w, "read error", http.StatusBadRequest)
+		return
+	}
+
+	// проверяем заказ по схеме и возвращаем список ошибок по полям
+	if s.validator != nil {
+		var validationErr *validation.ValidationError
+		err := s.validator.Validate(body)
+		if errors.As(err, &validationErr) {
+			log.Printf("[API] Заказ не прошел валидацию: %v", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(validationErr)
+			return
+		}
+		if err != nil {
+			log.Printf("[API] Ошибка при валидации заказа: %v", err)
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+	}
+
 	var order model.Order
-	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+	if err := json.Unmarshal(body, &order); err != nil {
 		log.Printf("[API] Ошибка при декодировании JSON для отправки в Kafka: %v", err)
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
+
+	// без Kafka сохраняем заказ сразу в хранилище и кэш
+	if s.kafkaWriter == nil {
+		order.Status = model.StatusCreated
+		err := s.store.SaveOrder(r.Context(), order)
+		switch {
+		case errors.Is(err, db.ErrOrderExists):
+			log.Printf("[API] Заказ %s уже сохранен: %v", order.OrderUID, err)
+			http.Error(w, "order already exists", http.StatusConflict)
+			return
+		case db.IsInvalidData(err):
+			log.Printf("[API] Заказ %s содержит некорректные данные: %v", order.OrderUID, err)
+			http.Error(w, "invalid order: "+err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			log.Printf("[API] Ошибка сохранения заказа %s: %v", order.OrderUID, err)
+			http.Error(w, "save error", http.StatusInternalServerError)
+			return
+		}
+		s.orderCache.Set(order)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+		return
+	}
+
 	msg, err := json.Marshal(order)
 	if err != nil {
 		log.Printf("[API] Ошибка при маршалинге заказа для отправки в Kafka: %v", err)
@@ -61,8 +149,9 @@ func (s *Server) handleKafkaProduce(w http.ResponseWriter, r *http.Request) {
 	}
 	err = s.kafkaWriter.WriteMessages(context.Background(),
 		kafka.Message{
-			Key:   []byte(order.OrderUID),
-			Value: msg,
+			Key:     []byte(order.OrderUID),
+			Value:   msg,
+			Headers: []kafka.Header{{Key: "schema-version", Value: []byte(validation.CurrentOrderSchemaVersion)}},
 		},
 	)
 	if err != nil {
@@ -83,7 +172,7 @@ func (s *Server) getOrderByUID(w http.ResponseWriter, r *http.Request) {
 	order, ok := s.orderCache.Get(orderUID)
 	if !ok {
 		log.Printf("[API] Заказ %s не найден в кэше", orderUID) // логируем что заказ не найден в кэше
-		order, err := s.database.GetOrder(r.Context(), orderUID)
+		order, err := s.store.GetOrder(r.Context(), orderUID)
 		if err != nil {
 			log.Printf("[API] Заказ %s не найден в БД: %s", orderUID, err) // логируем ошибку если заказ не найден в БД
 			http.Error(w, "Заказ не найден", http.StatusNotFound)          // отправляем ответ о том что заказ не найден
@@ -101,7 +190,129 @@ func (s *Server) getOrderByUID(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// структура тела запроса на смену статуса заказа
+type statusRequest struct {
+	Status  model.OrderStatus `json:"status"`
+	Comment string            `json:"comment"`
+}
+
+// функция для смены статуса заказа
+// допустимость перехода проверяется по жизненному циклу заказа
+func (s *Server) transitionOrderStatus(w http.ResponseWriter, r *http.Request) {
+	orderUID := mux.Vars(r)["order_uid"]
+
+	var req statusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[API] Ошибка при декодировании JSON для смены статуса: %v", err)
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if !req.Status.IsValid() {
+		http.Error(w, "unknown status", http.StatusBadRequest)
+		return
+	}
+
+	change, err := s.store.TransitionOrderStatus(r.Context(), orderUID, req.Status, req.Comment)
+	switch {
+	case errors.Is(err, sql.ErrNoRows): // pgx.ErrNoRows тоже сводится к sql.ErrNoRows
+		http.Error(w, "Заказ не найден", http.StatusNotFound)
+		return
+	case errors.Is(err, model.ErrInvalidStatusTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("[API] Ошибка смены статуса заказа %s: %v", orderUID, err)
+		http.Error(w, "status error", http.StatusInternalServerError)
+		return
+	}
+
+	// обновляем статус заказа в кэше
+	if order, ok := s.orderCache.Get(orderUID); ok {
+		order.Status = change.To
+		s.orderCache.Set(order)
+	}
+	log.Printf("[API] Статус заказа %s изменен на %s", orderUID, change.To)
+	json.NewEncoder(w).Encode(change)
+}
+
+// функция для получения истории статусов заказа
+func (s *Server) getStatusHistory(w http.ResponseWriter, r *http.Request) {
+	orderUID := mux.Vars(r)["order_uid"]
+
+	history, err := s.store.GetStatusHistory(r.Context(), orderUID)
+	if err != nil {
+		log.Printf("[API] Ошибка получения истории статусов заказа %s: %v", orderUID, err)
+		http.Error(w, "history error", http.StatusInternalServerError)
+		return
+	}
+	if len(history) == 0 {
+		http.Error(w, "Заказ не найден", http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(history)
+}
+
+// функция для получения исходного сообщения Kafka, из которого был сохранен заказ
+func (s *Server) getRawMessage(w http.ResponseWriter, r *http.Request) {
+	orderUID := mux.Vars(r)["order_uid"]
+
+	raw, err := s.database.GetRawMessage(r.Context(), orderUID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Исходное сообщение не найдено", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[API] Ошибка получения исходного сообщения для заказа %s: %v", orderUID, err)
+		http.Error(w, "source error", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(raw)
+}
+
+// функция для поиска заказов по названиям и брендам товаров
+// параметры запроса: q - поисковая строка, limit и offset - пагинация
+func (s *Server) searchOrders(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		http.Error(w, "missing query", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := queryInt(r, "limit", defaultSearchLimit)
+	if err != nil || limit <= 0 || limit > maxSearchLimit {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	orders, err := s.database.SearchOrders(r.Context(), query, limit, offset)
+	if err != nil {
+		log.Printf("[API] Ошибка поиска заказов по запросу %q: %v", query, err)
+		http.Error(w, "search error", http.StatusInternalServerError)
+		return
+	}
+	if orders == nil {
+		orders = []model.Order{} // пустой результат отдаем как [], а не null
+	}
+	json.NewEncoder(w).Encode(orders)
+}
+
+// функция для получения целочисленного параметра запроса
+// возвращаемое значение: значение параметра или значение по умолчанию, если параметр не задан, и ошибка, если параметр некорректен
+func queryInt(r *http.Request, key string, fallback int) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
+
 // функция для запуска сервера
+// возвращаемое значение: http.ErrServerClosed после вызова Shutdown или ошибка запуска
 func (s *Server) Start(addr string) error {
 
 	// используем gorilla/handlers для разрешения заголовков CORS
@@ -110,5 +321,18 @@ func (s *Server) Start(addr string) error {
 		handlers.AllowedMethods([]string{"GET", "POST", "OPTIONS"}), // разрешаем методы GET, POST, OPTIONS
 	)(s.router)
 
-	return http.ListenAndServe(addr, corsHandler)
+	s.httpServer.Addr = addr
+	s.httpServer.Handler = corsHandler
+	return s.httpServer.ListenAndServe()
+}
+
+// функция для остановки сервера
+// новые соединения не принимаются, запросы в обработке завершаются до истечения контекста, после чего закрывается писатель в Kafka
+// возвращаемое значение: ошибка, если запросы не завершились вовремя
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.httpServer.Shutdown(ctx)
+	if s.kafkaWriter != nil {
+		err = errors.Join(err, s.kafkaWriter.Close())
+	}
+	return err
 }
@@ -0,0 +1,368 @@
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"wb-tech-test/internal/db"
+	"wb-tech-test/internal/model"
+)
+
+const (
+	archiveBatchSize = 500                // количество заказов, архивируемых за одну итерацию
+	filePrefix       = "orders-"          // префикс имени файла архива
+	fileSuffix       = ".ndjson.gz"       // расширение файла архива (сжатый NDJSON)
+	dayLayout        = time.DateOnly      // формат даты в имени файла архива
+	fileMode         = os.FileMode(0o644) // права доступа к файлам архива
+	tempPrefix       = ".tmp-"            // префикс временных файлов, в которых собирается запись
+	corruptSuffix    = ".corrupt"         // суффикс копии поврежденного файла архива
+)
+
+// структура для архиватора старых заказов
+// заказы старше MaxAge переносятся из БД в сжатые NDJSON-файлы, по одному файлу на день создания заказа
+// индекс хранит в памяти order_uid каждого заказа в архиве (порядка сотни байт на заказ) и растет вместе с архивом;
+// при большом архиве поиск по нему стоит отключить (ARCHIVE_LOOKUP) или переносить старые файлы из каталога
+type Archiver struct {
+	Dir    string        // каталог с файлами архива
+	MaxAge time.Duration // возраст заказа, после которого он переносится в архив
+	DB     *db.DB        // БД
+
+	mu    sync.RWMutex      // для безопасного доступа к индексу
+	index map[string]string // ключ - orderUID, значение - имя файла архива с заказом
+}
+
+// конструктор для создания нового архиватора
+// при создании строится индекс заказов по уже существующим файлам архива
+// возвращаемое значение: указатель на архиватор и ошибка, если каталог архива недоступен
+func NewArchiver(dir string, maxAge time.Duration, database *db.DB) (*Archiver, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	a := &Archiver{
+		Dir:    dir,
+		MaxAge: maxAge,
+		DB:     database,
+		index:  make(map[string]string),
+	}
+	if err := a.buildIndex(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// функция для периодической архивации старых заказов
+// работает до отмены контекста
+func (a *Archiver) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := a.ArchiveOnce(ctx); err != nil {
+			log.Printf("[ARCHIVE] Ошибка архивации заказов: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// функция для переноса в архив всех заказов старше MaxAge
+// сначала неполные заказы (без delivery или payment) переносятся в карантин, так как их нельзя прочитать целиком;
+// заказ удаляется из БД только после того, как он записан на диск
+// возвращаемое значение: количество заархивированных заказов и ошибка, если архивация прервана
+func (a *Archiver) ArchiveOnce(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-a.MaxAge)
+	if err := a.quarantinePartial(ctx, cutoff); err != nil {
+		return 0, err
+	}
+
+	total := 0
+
+	for {
+		orders, err := a.DB.GetOrdersCreatedBefore(ctx, cutoff, archiveBatchSize)
+		if err != nil {
+			return total, err
+		}
+		if len(orders) == 0 {
+			break
+		}
+
+		if err := a.write(orders); err != nil {
+			return total, err
+		}
+		if err := a.DB.DeleteOrders(ctx, orders); err != nil {
+			return total, err
+		}
+
+		total += len(orders)
+		if len(orders) < archiveBatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("[ARCHIVE] В архив перенесено заказов: %d", total)
+	}
+	return total, nil
+}
+
+// функция для переноса в карантин неполных заказов старше cutoff
+// возвращаемое значение: ошибка, если заказы не перенесены
+func (a *Archiver) quarantinePartial(ctx context.Context, cutoff time.Time) error {
+	for {
+		issues, err := a.DB.PartialOrdersCreatedBefore(ctx, cutoff, archiveBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, issue := range issues {
+			log.Printf("[ARCHIVE] Заказ %s неполный (%s), переносим в карантин вместо архива", issue.OrderUID, issue.Kind)
+			if _, err := a.DB.QuarantineOrder(ctx, issue); err != nil {
+				return err
+			}
+		}
+		if len(issues) < archiveBatchSize {
+			return nil
+		}
+	}
+}
+
+// функция для поиска заказа в архиве
+// возвращаемое значение: заказ, флаг наличия заказа в архиве и ошибка чтения архива
+func (a *Archiver) FindOrder(ctx context.Context, orderUID string) (model.Order, bool, error) {
+	a.mu.RLock()
+	name, ok := a.index[orderUID]
+	a.mu.RUnlock()
+	if !ok {
+		return model.Order{}, false, nil
+	}
+
+	var found model.Order
+	var exists bool
+	err := readFile(filepath.Join(a.Dir, name), func(order model.Order) {
+		if order.OrderUID == orderUID {
+			found, exists = order, true // при повторной архивации берем последнюю запись
+		}
+	})
+	return found, exists, err
+}
+
+// функция для дозаписи заказов в файлы архива, сгруппированных по дню создания
+// возвращаемое значение: ошибка, если заказы не записаны
+func (a *Archiver) write(orders []model.Order) error {
+	byDay := make(map[string][]model.Order)
+	for _, order := range orders {
+		name := fileName(order.DateCreated)
+		byDay[name] = append(byDay[name], order)
+	}
+
+	for name, dayOrders := range byDay {
+		if err := appendFile(filepath.Join(a.Dir, name), dayOrders); err != nil {
+			log.Printf("[ARCHIVE] Ошибка записи в файл %s: %v", name, err)
+			return err
+		}
+
+		a.mu.Lock()
+		for _, order := range dayOrders {
+			a.index[order.OrderUID] = name
+		}
+		a.mu.Unlock()
+	}
+	return nil
+}
+
+// функция для построения индекса заказов по существующим файлам архива
+// поврежденный файл (например, после сбоя при записи прежней версией) не останавливает запуск:
+// заказы, прочитанные до места повреждения, попадают в индекс, а файл перезаписывается только ими;
+// оставшиеся после прерванной записи временные файлы удаляются
+// возвращаемое значение: ошибка, если каталог архива не прочитан или поврежденный файл не восстановлен
+func (a *Archiver) buildIndex() error {
+	temps, err := filepath.Glob(filepath.Join(a.Dir, tempPrefix+"*"))
+	if err != nil {
+		return err
+	}
+	for _, path := range temps {
+		log.Printf("[ARCHIVE] Удаление временного файла прерванной записи %s", filepath.Base(path))
+		if err := os.Remove(path); err != nil {
+			log.Printf("[ARCHIVE] Ошибка удаления файла %s: %v", filepath.Base(path), err)
+		}
+	}
+
+	names, err := filepath.Glob(filepath.Join(a.Dir, filePrefix+"*"+fileSuffix))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, path := range names {
+		name := filepath.Base(path)
+		var orders []model.Order
+		err := readFile(path, func(order model.Order) {
+			a.index[order.OrderUID] = name
+			orders = append(orders, order)
+		})
+		if err == nil {
+			continue
+		}
+
+		log.Printf("[ARCHIVE] Файл %s поврежден, восстанавливаем заказы до места повреждения (%d): %v", name, len(orders), err)
+		if err := repairFile(path, orders); err != nil {
+			log.Printf("[ARCHIVE] Ошибка восстановления файла %s: %v", name, err)
+			return err
+		}
+	}
+	log.Printf("[ARCHIVE] Индекс архива построен, количество заказов: %d", len(a.index))
+	return nil
+}
+
+// функция для получения имени файла архива по дате создания заказа
+// возвращаемое значение: имя файла, например orders-2021-11-26.ndjson.gz
+func fileName(dateCreated time.Time) string {
+	return filePrefix + dateCreated.UTC().Format(dayLayout) + fileSuffix
+}
+
+// функция для дозаписи заказов в файл архива
+// каждая дозапись добавляет в файл отдельный gzip-поток, gzip.Reader читает их подряд
+// возвращаемое значение: ошибка, если заказы не записаны
+func appendFile(path string, orders []model.Order) error {
+	return replaceFile(path, func(w io.Writer) error {
+		if err := copyExisting(w, path); err != nil {
+			return err
+		}
+		return writeOrders(w, orders)
+	})
+}
+
+// функция для записи заказов отдельным gzip-потоком
+// возвращаемое значение: ошибка, если заказы не записаны
+func writeOrders(w io.Writer, orders []model.Order) error {
+	zw := gzip.NewWriter(w)
+	encoder := json.NewEncoder(zw) // Encode добавляет перевод строки после каждого заказа
+	for _, order := range orders {
+		if err := encoder.Encode(order); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// функция для замены файла архива новым содержимым
+// содержимое собирается во временном файле, который заменяет файл архива только после записи на диск,
+// поэтому прерванная запись не оставляет в архиве оборванный gzip-поток
+// возвращаемое значение: ошибка, если файл не заменен (в этом случае прежний файл остается без изменений)
+func replaceFile(path string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(path)
+	temp, err := os.CreateTemp(dir, tempPrefix+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name()) // после успешного переименования временного файла уже нет
+	defer temp.Close()
+
+	if err := write(temp); err != nil {
+		return err
+	}
+	// заказы будут удалены из БД, поэтому убеждаемся, что они записаны на диск до замены файла
+	if err := temp.Sync(); err != nil {
+		return err
+	}
+	if err := temp.Chmod(fileMode); err != nil {
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir) // фиксируем на диске само переименование
+}
+
+// функция для восстановления поврежденного файла архива
+// файл перезаписывается заказами, прочитанными до места повреждения, чтобы последующие дозаписи оставались читаемыми;
+// исходный файл сохраняется рядом с суффиксом .corrupt для ручного разбора
+// возвращаемое значение: ошибка, если файл не восстановлен
+func repairFile(path string, orders []model.Order) error {
+	if err := copyFile(path+corruptSuffix, path); err != nil {
+		return err
+	}
+	return replaceFile(path, func(w io.Writer) error {
+		return writeOrders(w, orders)
+	})
+}
+
+// функция для копирования файла
+// возвращаемое значение: ошибка, если файл не скопирован
+func copyFile(dst, src string) error {
+	return replaceFile(dst, func(w io.Writer) error {
+		return copyExisting(w, src)
+	})
+}
+
+// функция для копирования существующего файла архива во временный файл
+// возвращаемое значение: ошибка, если файл не скопирован (отсутствие файла ошибкой не считается)
+func copyExisting(dst io.Writer, path string) error {
+	src, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// функция для записи на диск изменений каталога (создания и переименования файлов)
+// возвращаемое значение: ошибка, если каталог не синхронизирован
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// функция для чтения всех заказов из файла архива
+// возвращаемое значение: ошибка, если файл не прочитан
+func readFile(path string, fn func(order model.Order)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	decoder := json.NewDecoder(zr) // NDJSON читается как последовательность JSON-значений
+	for {
+		var order model.Order
+		err := decoder.Decode(&order)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fn(order)
+	}
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ошибка, возвращаемая при неизвестном интервале группировки по времени
+var ErrInvalidBucket = errors.New("неизвестный интервал группировки")
+
+// допустимые интервалы группировки выручки по времени (аргумент date_trunc)
+var revenueBuckets = map[string]bool{"day": true, "week": true, "month": true}
+
+// структура для строки отчета о выручке
+// суммы в разных валютах не складываются, поэтому строки разбиты по валютам
+type ReportRow struct {
+	Key      string `json:"key"`                // значение группировки (бренд, дата, служба доставки или валюта)
+	Currency string `json:"currency,omitempty"` // валюта выручки (пустая в отчете по валютам)
+	Orders   int    `json:"orders"`             // количество заказов
+	Revenue  int64  `json:"revenue"`            // выручка
+}
+
+// функция для получения выручки по брендам (сумма total_price товаров)
+// возвращаемое значение: строки отчета по убыванию выручки и ошибка, если отчет не построен
+func (db *DB) RevenueByBrand(ctx context.Context, from, to time.Time) ([]ReportRow, error) {
+	args := []any{}
+	return db.revenueReport(ctx, "brand", fmt.Sprintf(`
+		SELECT COALESCE(i.brand, ''), COALESCE(p.currency, ''), COUNT(DISTINCT i.order_uid), COALESCE(SUM(i.total_price), 0)
+		FROM items i
+		JOIN payment p ON p.order_uid = i.order_uid AND p.date_created = i.date_created
+		WHERE %s
+		GROUP BY 1, 2
+		ORDER BY 4 DESC, 1
+	`, dateRange("i.date_created", from, to, &args)), args...)
+}
+
+// функция для получения выручки по интервалам времени (сумма amount оплат)
+// bucket - интервал группировки: day, week или month (границы интервалов считаются в UTC)
+// возвращаемое значение: строки отчета в хронологическом порядке и ошибка (ErrInvalidBucket, если интервал неизвестен)
+func (db *DB) RevenueByPeriod(ctx context.Context, from, to time.Time, bucket string) ([]ReportRow, error) {
+	if !revenueBuckets[bucket] {
+		return nil, ErrInvalidBucket
+	}
+
+	args := []any{bucket}
+	return db.revenueReport(ctx, bucket, fmt.Sprintf(`
+		SELECT to_char(date_trunc($1, p.date_created AT TIME ZONE 'UTC'), 'YYYY-MM-DD'), COALESCE(p.currency, ''), COUNT(*), COALESCE(SUM(p.amount), 0)
+		FROM payment p
+		WHERE %s
+		GROUP BY 1, 2
+		ORDER BY 1, 2
+	`, dateRange("p.date_created", from, to, &args)), args...)
+}
+
+// функция для получения выручки по службам доставки (сумма amount оплат)
+// возвращаемое значение: строки отчета по убыванию выручки и ошибка, если отчет не построен
+func (db *DB) RevenueByDeliveryService(ctx context.Context, from, to time.Time) ([]ReportRow, error) {
+	args := []any{}
+	return db.revenueReport(ctx, "delivery_service", fmt.Sprintf(`
+		SELECT COALESCE(o.delivery_service, ''), COALESCE(p.currency, ''), COUNT(*), COALESCE(SUM(p.amount), 0)
+		FROM orders o
+		JOIN payment p ON p.order_uid = o.order_uid AND p.date_created = o.date_created
+		WHERE %s
+		GROUP BY 1, 2
+		ORDER BY 4 DESC, 1
+	`, dateRange("o.date_created", from, to, &args)), args...)
+}
+
+// функция для получения выручки по валютам (сумма amount оплат)
+// возвращаемое значение: строки отчета по убыванию выручки и ошибка, если отчет не построен
+func (db *DB) RevenueByCurrency(ctx context.Context, from, to time.Time) ([]ReportRow, error) {
+	args := []any{}
+	return db.revenueReport(ctx, "currency", fmt.Sprintf(`
+		SELECT COALESCE(p.currency, ''), '', COUNT(*), COALESCE(SUM(p.amount), 0)
+		FROM payment p
+		WHERE %s
+		GROUP BY 1
+		ORDER BY 4 DESC, 1
+	`, dateRange("p.date_created", from, to, &args)), args...)
+}
+
+// функция для выполнения запроса отчета о выручке
+// возвращаемое значение: строки отчета и ошибка, если запрос не выполнен
+func (db *DB) revenueReport(ctx context.Context, name, query string, args ...any) ([]ReportRow, error) {
+	pool, _ := db.readPool("")
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		log.Printf("[DB] Ошибка построения отчета о выручке (%s): %v", name, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []ReportRow{}
+	for rows.Next() {
+		var row ReportRow
+		if err := rows.Scan(&row.Key, &row.Currency, &row.Orders, &row.Revenue); err != nil {
+			log.Printf("[DB] Ошибка сканирования отчета о выручке (%s): %v", name, err)
+			return nil, err
+		}
+		report = append(report, row)
+	}
+	return report, rows.Err()
+}
+
+// функция для построения условия по диапазону дат создания заказа
+// нулевые границы не ограничивают диапазон; условие по date_created позволяет отсекать лишние партиции
+// возвращаемое значение: SQL-условие, параметры которого добавлены в args
+func dateRange(column string, from, to time.Time, args *[]any) string {
+	condition := "TRUE"
+	if !from.IsZero() {
+		*args = append(*args, from)
+		condition += fmt.Sprintf(" AND %s >= $%d", column, len(*args))
+	}
+	if !to.IsZero() {
+		*args = append(*args, to)
+		condition += fmt.Sprintf(" AND %s < $%d", column, len(*args))
+	}
+	return condition
+}
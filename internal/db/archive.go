@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"log"
+	"time"
+	"wb-tech-test/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// интерфейс архива заказов, удаленных из основных таблиц
+// используется в GetOrder для поиска заказов, которых уже нет в БД
+type OrderArchive interface {
+	// функция для поиска заказа в архиве
+	// возвращаемое значение: заказ, флаг наличия заказа в архиве и ошибка чтения архива
+	FindOrder(ctx context.Context, orderUID string) (model.Order, bool, error)
+}
+
+// функция для подключения архива, в котором GetOrder ищет заказы, отсутствующие в БД
+func (db *DB) SetArchive(archive OrderArchive) {
+	db.archive = archive
+}
+
+// функция для получения заказов, созданных раньше указанного момента
+// заказы без delivery или payment не могут быть прочитаны целиком и пропускаются,
+// их находит PartialOrdersCreatedBefore, чтобы перенести в карантин
+// возвращаемое значение: слайс заказов (не больше limit, от самых старых) и ошибка, если заказы не получены
+func (db *DB) GetOrdersCreatedBefore(ctx context.Context, before time.Time, limit int) ([]model.Order, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT o.order_uid FROM orders o
+		WHERE o.date_created < $1
+			AND EXISTS (SELECT 1 FROM delivery d WHERE d.order_uid = o.order_uid AND d.date_created = o.date_created)
+			AND EXISTS (SELECT 1 FROM payment p WHERE p.order_uid = o.order_uid AND p.date_created = o.date_created)
+		ORDER BY o.date_created, o.order_uid
+		LIMIT $2
+	`, before, limit)
+	if err != nil {
+		log.Printf("[DB] Ошибка получения заказов старше %s: %v", before.Format(time.RFC3339), err)
+		return nil, err
+	}
+
+	orderUIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		log.Printf("[DB] Ошибка сканирования order_uid: %v", err)
+		return nil, err
+	}
+
+	orders := make([]model.Order, 0, len(orderUIDs))
+	for _, orderUID := range orderUIDs {
+		order, err := db.GetOrder(ctx, orderUID)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
+// функция для поиска неполных заказов (без delivery или payment), созданных раньше указанного момента
+// такие заказы не архивируются, архиватор переносит их в карантин через QuarantineOrder
+// возвращаемое значение: слайс нарушений (не больше limit, от самых старых) и ошибка, если заказы не получены
+func (db *DB) PartialOrdersCreatedBefore(ctx context.Context, before time.Time, limit int) ([]Issue, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT order_uid, date_created, kind FROM (
+			SELECT o.order_uid, o.date_created,
+				CASE
+					WHEN NOT EXISTS (SELECT 1 FROM delivery d WHERE d.order_uid = o.order_uid AND d.date_created = o.date_created) THEN $3
+					WHEN NOT EXISTS (SELECT 1 FROM payment p WHERE p.order_uid = o.order_uid AND p.date_created = o.date_created) THEN $4
+					ELSE ''
+				END AS kind
+			FROM orders o
+			WHERE o.date_created < $1
+		) partial
+		WHERE kind <> ''
+		ORDER BY date_created, order_uid
+		LIMIT $2
+	`, before, limit, IssueMissingDelivery, IssueMissingPayment)
+	if err != nil {
+		log.Printf("[DB] Ошибка поиска неполных заказов старше %s: %v", before.Format(time.RFC3339), err)
+		return nil, err
+	}
+
+	issues, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Issue, error) {
+		var issue Issue
+		err := row.Scan(&issue.OrderUID, &issue.DateCreated, &issue.Kind)
+		return issue, err
+	})
+	if err != nil {
+		log.Printf("[DB] Ошибка сканирования неполных заказов: %v", err)
+		return nil, err
+	}
+	return issues, nil
+}
+
+// функция для удаления заказов (вместе с delivery, payment, items, историей статусов, исходными сообщениями Kafka и событиями outbox) из БД в одной транзакции
+// исходное сообщение удаляется, чтобы повторно полученный заказ с тем же order_uid можно было сохранить,
+// а события outbox - чтобы ретранслятор не отправлял события заказа, которого уже нет в БД
+// возвращаемое значение: ошибка, если заказы не удалены
+func (db *DB) DeleteOrders(ctx context.Context, orders []model.Order) (err error) {
+	tx, err := db.Pool.Begin(ctx) // создаем транзакцию
+	if err != nil {
+		log.Printf("[DB] Ошибка при создании транзакции: %v", err)
+		return err
+	}
+	defer func() {
+		if err != nil {
+			log.Printf("[DB] Откатываем транзакцию: %v", err)
+			tx.Rollback(ctx) // откатываем транзакцию, если возникла ошибка
+		}
+	}()
+
+	// сначала удаляем дочерние строки, затем сам заказ
+	batch := &pgx.Batch{}
+	for _, order := range orders {
+		for _, table := range []string{"raw_messages", "status_history", "outbox"} {
+			batch.Queue(`DELETE FROM `+table+` WHERE order_uid = $1`, order.OrderUID)
+		}
+		for _, table := range []string{"items", "payment", "delivery", "orders"} {
+			batch.Queue(`DELETE FROM `+table+` WHERE order_uid = $1 AND date_created = $2`, order.OrderUID, order.DateCreated)
+		}
+	}
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+		log.Printf("[DB] Ошибка удаления заказов: %v", err)
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	return err
+}
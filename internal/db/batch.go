@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"log"
+	"wb-tech-test/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// структура заказа, полученного из Kafka, в составе пакета
+type BatchOrder struct {
+	Order  model.Order   // заказ
+	Source SourceMessage // исходное сообщение
+}
+
+// интерфейс хранилища, умеющего сохранять пакет заказов в одной транзакции
+// реализуется только Postgres
+type BatchOrderStore interface {
+	SaveOrderBatch(ctx context.Context, batch []BatchOrder, last SourceMessage, reject func(BatchOrder, error) error) ([]model.Order, error)
+}
+
+// проверка на этапе компиляции, что DB реализует BatchOrderStore
+var _ BatchOrderStore = (*DB)(nil)
+
+// функция для сохранения пакета заказов из Kafka в одной транзакции
+// каждый заказ сохраняется в своей точке сохранения (savepoint): заказ с постоянной ошибкой откатывается
+// и передается в reject, не прерывая сохранение остальных; смещение last сохраняется в той же транзакции после всех заказов
+// возвращаемое значение: сохраненные заказы и ошибка, если пакет не сохранен целиком (временная ошибка или ошибка reject)
+func (db *DB) SaveOrderBatch(ctx context.Context, batch []BatchOrder, last SourceMessage, reject func(BatchOrder, error) error) (saved []model.Order, err error) {
+	tx, err := db.Pool.Begin(ctx) // создаем транзакцию
+	if err != nil {
+		log.Printf("[DB] Ошибка при создании транзакции: %v", err)
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			log.Printf("[DB] Откатываем транзакцию пакета: %v", err)
+			tx.Rollback(ctx) // откатываем транзакцию, если возникла ошибка
+		}
+	}()
+
+	for _, item := range batch {
+		var savepoint pgx.Tx
+		savepoint, err = tx.Begin(ctx) // вложенная транзакция pgx создает savepoint
+		if err != nil {
+			return nil, err
+		}
+
+		source := item.Source
+		source.DeferOffset = true // смещение сохраняется один раз для всего пакета
+		if err = db.saveOrderTx(ctx, savepoint, item.Order, &source); err != nil {
+			savepoint.Rollback(ctx)
+			if IsTransient(err) {
+				return nil, err // временная ошибка прерывает транзакцию - пакет сохраняется повторно
+			}
+			log.Printf("[DB] Заказ %s исключен из пакета: %v", item.Order.OrderUID, err)
+			if err = reject(item, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err = savepoint.Commit(ctx); err != nil {
+			return nil, err
+		}
+		saved = append(saved, item.Order)
+	}
+
+	// сохраняем смещение последнего сообщения пакета
+	if err = db.saveKafkaOffset(ctx, tx, last); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	for _, order := range saved {
+		db.markRecent(order.OrderUID) // сразу после сохранения читаем заказы с primary
+	}
+	log.Printf("[DB] Пакет сохранен: %d из %d заказов, смещение %d", len(saved), len(batch), last.Offset)
+	return saved, nil
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// виды нарушений целостности заказов
+const (
+	IssueMissingDelivery    = "missing_delivery"     // у заказа нет delivery
+	IssueMissingPayment     = "missing_payment"      // у заказа нет payment
+	IssueMissingItems       = "missing_items"        // у заказа нет items
+	IssueOrphanDelivery     = "orphan_delivery"      // delivery без заказа
+	IssueOrphanPayment      = "orphan_payment"       // payment без заказа
+	IssueOrphanItems        = "orphan_items"         // items без заказа
+	IssueGoodsTotalMismatch = "goods_total_mismatch" // goods_total не равен сумме total_price товаров
+	IssueAmountMismatch     = "amount_mismatch"      // amount не равен goods_total + delivery_cost + custom_fee
+)
+
+// структура для найденного нарушения целостности
+type Issue struct {
+	Kind        string    // вид нарушения
+	OrderUID    string    // UID заказа
+	DateCreated time.Time // дата создания заказа (ключ партиции)
+	Details     string    // подробности (для расхождений сумм)
+}
+
+// проверки целостности: вид нарушения и запрос, возвращающий order_uid, date_created и подробности
+var consistencyChecks = []struct {
+	kind  string
+	query string
+}{
+	{IssueMissingDelivery, `
+		SELECT o.order_uid, o.date_created, '' FROM orders o
+		WHERE NOT EXISTS (SELECT 1 FROM delivery d WHERE d.order_uid = o.order_uid AND d.date_created = o.date_created)`},
+	{IssueMissingPayment, `
+		SELECT o.order_uid, o.date_created, '' FROM orders o
+		WHERE NOT EXISTS (SELECT 1 FROM payment p WHERE p.order_uid = o.order_uid AND p.date_created = o.date_created)`},
+	{IssueMissingItems, `
+		SELECT o.order_uid, o.date_created, '' FROM orders o
+		WHERE NOT EXISTS (SELECT 1 FROM items i WHERE i.order_uid = o.order_uid AND i.date_created = o.date_created)`},
+	{IssueOrphanDelivery, `
+		SELECT d.order_uid, d.date_created, '' FROM delivery d
+		WHERE NOT EXISTS (SELECT 1 FROM orders o WHERE o.order_uid = d.order_uid AND o.date_created = d.date_created)`},
+	{IssueOrphanPayment, `
+		SELECT p.order_uid, p.date_created, format('transaction=%s', p.transaction) FROM payment p
+		WHERE NOT EXISTS (SELECT 1 FROM orders o WHERE o.order_uid = p.order_uid AND o.date_created = p.date_created)`},
+	{IssueOrphanItems, `
+		SELECT i.order_uid, i.date_created, format('items=%s', COUNT(*)) FROM items i
+		WHERE NOT EXISTS (SELECT 1 FROM orders o WHERE o.order_uid = i.order_uid AND o.date_created = i.date_created)
+		GROUP BY i.order_uid, i.date_created`},
+	{IssueGoodsTotalMismatch, `
+		SELECT p.order_uid, p.date_created, format('goods_total=%s, сумма total_price=%s', p.goods_total, SUM(i.total_price)) FROM payment p
+		JOIN items i ON i.order_uid = p.order_uid AND i.date_created = p.date_created
+		GROUP BY p.order_uid, p.date_created, p.goods_total
+		HAVING p.goods_total IS DISTINCT FROM SUM(i.total_price)`},
+	{IssueAmountMismatch, `
+		SELECT p.order_uid, p.date_created, format('amount=%s, goods_total=%s, delivery_cost=%s, custom_fee=%s', p.amount, p.goods_total, p.delivery_cost, p.custom_fee) FROM payment p
+		WHERE p.amount IS DISTINCT FROM p.goods_total + p.delivery_cost + p.custom_fee`},
+}
+
+// функция для поиска нарушений целостности заказов
+// проверяются заказы без delivery/payment/items, строки без заказа и расхождения сумм в payment
+// возвращаемое значение: слайс найденных нарушений и ошибка, если проверка не выполнена
+func (db *DB) CheckConsistency(ctx context.Context) ([]Issue, error) {
+	var issues []Issue
+	for _, check := range consistencyChecks {
+		rows, err := db.Pool.Query(ctx, check.query)
+		if err != nil {
+			log.Printf("[DB] Ошибка проверки %s: %v", check.kind, err)
+			return nil, err
+		}
+
+		found, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Issue, error) {
+			issue := Issue{Kind: check.kind}
+			err := row.Scan(&issue.OrderUID, &issue.DateCreated, &issue.Details)
+			return issue, err
+		})
+		if err != nil {
+			log.Printf("[DB] Ошибка сканирования результата проверки %s: %v", check.kind, err)
+			return nil, err
+		}
+		issues = append(issues, found...)
+	}
+	return issues, nil
+}
+
+// функция для переноса всех строк заказа (orders, delivery, payment, items, status_history, raw_messages, outbox) в таблицу quarantine
+// строки сохраняются в quarantine в виде JSON и удаляются из основных таблиц в одной транзакции
+// возвращаемое значение: количество перенесенных строк и ошибка, если перенос не выполнен
+func (db *DB) QuarantineOrder(ctx context.Context, issue Issue) (moved int64, err error) {
+	tx, err := db.Pool.Begin(ctx) // создаем транзакцию
+	if err != nil {
+		log.Printf("[DB] Ошибка при создании транзакции: %v", err)
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			log.Printf("[DB] Откатываем транзакцию: %v", err)
+			tx.Rollback(ctx) // откатываем транзакцию, если возникла ошибка
+		}
+	}()
+
+	// сначала дочерние строки, затем сам заказ; история статусов, исходное сообщение и события outbox
+	// связаны с заказом только по order_uid и переносятся, если заказа с таким order_uid больше нет
+	for _, table := range []string{"items", "payment", "delivery", "orders", "status_history", "raw_messages", "outbox"} {
+		condition := "t.order_uid = $1 AND t.date_created = $2"
+		if !partitionedTable(table) {
+			condition = "t.order_uid = $1 AND NOT EXISTS (SELECT 1 FROM orders o WHERE o.order_uid = $1)"
+		}
+		tag, err := tx.Exec(ctx, `
+			WITH moved AS (
+				DELETE FROM `+table+` t WHERE `+condition+` RETURNING t.*
+			)
+			INSERT INTO quarantine (order_uid, date_created, reason, source_table, row_data)
+			SELECT $1, $2, $3, $4, to_jsonb(moved) - 'search_vector' FROM moved
+		`, issue.OrderUID, issue.DateCreated, issue.Kind, table)
+		if err != nil {
+			log.Printf("[DB] Ошибка переноса строк заказа %s из %s в карантин: %v", issue.OrderUID, table, err)
+			return moved, err
+		}
+		moved += tag.RowsAffected()
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return moved, err
+	}
+	log.Printf("[DB] Заказ %s перенесен в карантин (%s), строк: %d", issue.OrderUID, issue.Kind, moved)
+	return moved, nil
+}
+
+// функция для исправления goods_total в payment по сумме total_price товаров заказа
+// возвращаемое значение: ошибка, если payment не обновлен
+func (db *DB) RepairGoodsTotal(ctx context.Context, issue Issue) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE payment p
+		SET goods_total = (
+			SELECT SUM(i.total_price) FROM items i
+			WHERE i.order_uid = p.order_uid AND i.date_created = p.date_created
+		)
+		WHERE p.order_uid = $1 AND p.date_created = $2
+	`, issue.OrderUID, issue.DateCreated)
+	if err != nil {
+		log.Printf("[DB] Ошибка исправления goods_total для заказа %s: %v", issue.OrderUID, err)
+		return err
+	}
+	log.Printf("[DB] goods_total для заказа %s исправлен", issue.OrderUID)
+	return nil
+}
+
+// функция для проверки, секционирована ли таблица по date_created
+// возвращаемое значение: true для orders, delivery, payment и items
+func partitionedTable(table string) bool {
+	return slices.Contains(partitionedTables, table)
+}
@@ -5,14 +5,20 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sync/atomic"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 )
 
 // структура для хранения пула соединений с базой данных
 type DB struct {
-	Pool *pgxpool.Pool // функция из библиотеки pgx для создания пула соединений
+	Pool        *pgxpool.Pool // функция из библиотеки pgx для создания пула соединений
+	archive     OrderArchive  // архив заказов, удаленных из БД (может отсутствовать)
+	replicas    []*replica    // реплики для чтения (могут отсутствовать)
+	nextReplica atomic.Uint32 // счетчик для выбора реплики по кругу
+	recent      *recentWrites // недавно сохраненные заказы, читаемые с primary
 }
 
 // конструктор для создания нового пула соединений
@@ -30,15 +36,53 @@ func NewDB() *DB {
 		log.Fatalf("[DB] Ошибка при создании пула: %v", err)
 	}
 
+	// создание пулов соединений с репликами для чтения, если они заданы
+	replicas := newReplicas(os.Getenv("PG_REPLICA_DSNS"))
+	if len(replicas) > 0 {
+		log.Printf("[DB] Чтение распределяется по репликам: %d шт.", len(replicas))
+	}
+
 	return &DB{
-		Pool: pool,
+		Pool:     pool,
+		replicas: replicas,
+		recent:   newRecentWrites(),
 	}
 }
 
+// функция для проверки существования транзакции оплаты
+// возвращаемое значение: true, если транзакция существует, и ошибка, если проверка не выполнена
 func (db *DB) IsTransactionExists(ctx context.Context, transaction string) (bool, error) {
+	return isTransactionExists(ctx, db.Pool, transaction)
+}
+
+// функция для проверки существования заказа с указанным order_uid
+// возвращаемое значение: true, если заказ существует, и ошибка, если проверка не выполнена
+func (db *DB) IsOrderExists(ctx context.Context, orderUID string) (bool, error) {
+	return isOrderExists(ctx, db.Pool, orderUID)
+}
+
+// интерфейс для выполнения запроса, возвращающего одну строку (пул соединений или транзакция)
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// функция для проверки существования транзакции оплаты через пул или в рамках транзакции
+// в транзакции видны и заказы, сохраненные в ней ранее (например, в том же пакете)
+// возвращаемое значение: true, если транзакция существует, и ошибка, если проверка не выполнена
+func isTransactionExists(ctx context.Context, q rowQuerier, transaction string) (bool, error) {
 	var exists bool
-	err := db.Pool.QueryRow(ctx, `
+	err := q.QueryRow(ctx, `
         SELECT EXISTS(SELECT 1 FROM payment WHERE transaction = $1)
     `, transaction).Scan(&exists)
 	return exists, err
 }
+
+// функция для проверки существования заказа через пул или в рамках транзакции
+// возвращаемое значение: true, если заказ существует, и ошибка, если проверка не выполнена
+func isOrderExists(ctx context.Context, q rowQuerier, orderUID string) (bool, error) {
+	var exists bool
+	err := q.QueryRow(ctx, `
+        SELECT EXISTS(SELECT 1 FROM orders WHERE order_uid = $1)
+    `, orderUID).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// основные коды результата SQLite (расширенные коды содержат основной в младшем байте)
+const (
+	sqliteBusy       = 5  // SQLITE_BUSY: база заблокирована другим соединением
+	sqliteLocked     = 6  // SQLITE_LOCKED: таблица заблокирована в том же соединении
+	sqliteConstraint = 19 // SQLITE_CONSTRAINT: нарушено ограничение таблицы
+	sqliteMismatch   = 20 // SQLITE_MISMATCH: тип значения не подходит столбцу
+)
+
+// интерфейс ошибки SQLite (modernc.org/sqlite) с кодом результата
+type sqliteError interface {
+	error
+	Code() int
+}
+
+// функция для классификации ошибки сохранения заказа
+// временными считаются ошибки соединения, таймауты, конфликты сериализации, взаимоблокировки и блокировки SQLite -
+// такую операцию можно повторить; остальные ошибки (дубликаты, нарушения ограничений, некорректные данные) постоянные
+// возвращаемое значение: true, если операцию стоит повторить
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, ErrOrderExists) {
+		return false
+	}
+
+	// отмена контекста означает остановку, а не сбой БД
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case strings.HasPrefix(pgErr.Code, "08"): // connection exception
+			return true
+		case pgErr.Code == "40001", pgErr.Code == "40P01": // serialization_failure, deadlock_detected
+			return true
+		case pgErr.Code == "53300", pgErr.Code == "55P03": // too_many_connections, lock_not_available
+			return true
+		case pgErr.Code == "57P01", pgErr.Code == "57P02", pgErr.Code == "57P03": // остановка или перезапуск сервера
+			return true
+		}
+		return false
+	}
+
+	var liteErr sqliteError
+	if errors.As(err, &liteErr) {
+		code := liteErr.Code() & 0xff
+		return code == sqliteBusy || code == sqliteLocked
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) || pgconn.Timeout(err) || pgconn.SafeToRetry(err) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// функция для проверки, вызвана ли ошибка сохранения некорректными данными заказа, а не сбоем БД
+// такими считаются нарушения ограничений (кроме дубликатов, для них возвращается ErrOrderExists) и недопустимые значения
+// возвращаемое значение: true, если заказ нужно исправить, а не сохранять повторно
+func IsInvalidData(err error) bool {
+	if err == nil || errors.Is(err, ErrOrderExists) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 22 - data exception (значение вне диапазона, неверный формат), 23 - integrity constraint violation
+		return strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23")
+	}
+
+	var liteErr sqliteError
+	if errors.As(err, &liteErr) {
+		code := liteErr.Code() & 0xff
+		return code == sqliteConstraint || code == sqliteMismatch
+	}
+	return false
+}
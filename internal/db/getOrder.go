@@ -2,18 +2,52 @@ package db
 
 import (
 	"context"
+	"errors"
 	"log"
+	"time"
 	"wb-tech-test/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // функция для получения заказа (а также связанные delivery, payment и items) по order_uid
+// чтение идет с реплики, если она доступна; при ошибке или отставании реплики запрос повторяется на primary
 // возвращаемое значение: экземпляр структуры Order и ошибку, если заказ не найден
 func (db *DB) GetOrder(ctx context.Context, orderUID string) (model.Order, error) {
+	pool, replica := db.readPool(orderUID)
+	order, err := db.getOrderFrom(ctx, pool, orderUID)
+	if err != nil && replica != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			replica.markUnhealthy(err) // реплика недоступна - не используем ее до следующей проверки
+		}
+		// заказа может еще не быть на реплике из-за задержки репликации, поэтому повторяем запрос на primary
+		order, err = db.getOrderFrom(ctx, db.Pool, orderUID)
+	}
+
+	// если заказа нет в БД, ищем его в архиве
+	if errors.Is(err, pgx.ErrNoRows) && db.archive != nil {
+		archived, found, archiveErr := db.archive.FindOrder(ctx, orderUID)
+		if archiveErr != nil {
+			log.Printf("[DB] Ошибка поиска заказа %s в архиве: %v", orderUID, archiveErr)
+			return order, archiveErr
+		}
+		if found {
+			log.Printf("[DB] Заказ %s найден в архиве", orderUID)
+			return archived, nil
+		}
+	}
+	return order, err
+}
+
+// функция для получения заказа вместе со связанными данными из указанного пула соединений
+// возвращаемое значение: экземпляр структуры Order и ошибку, если заказ не найден
+func (db *DB) getOrderFrom(ctx context.Context, pool *pgxpool.Pool, orderUID string) (model.Order, error) {
 	var order model.Order // объявляем экземпляр типа Order
 
 	// получаем основную информацию о заказе
-	row := db.Pool.QueryRow(ctx, `
-	SELECT order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
+	row := pool.QueryRow(ctx, `
+	SELECT order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, status
 	FROM orders
 	WHERE order_uid = $1
 	`, orderUID)
@@ -31,6 +65,7 @@ func (db *DB) GetOrder(ctx context.Context, orderUID string) (model.Order, error
 		&order.SmID,
 		&order.DateCreated,
 		&order.OofShard,
+		&order.Status,
 	)
 
 	// логгируем и возвращаем ошибку, если таковая есть
@@ -39,19 +74,19 @@ func (db *DB) GetOrder(ctx context.Context, orderUID string) (model.Order, error
 		return order, err
 	}
 
-	delivery, err := db.getDeliveryByOrderUID(ctx, orderUID) // получаем связанные данные о доставке
+	delivery, err := db.getDeliveryByOrderUID(ctx, pool, orderUID, order.DateCreated) // получаем связанные данные о доставке
 	if err != nil {
-		return order, nil
+		return order, err
 	}
 	order.Delivery = delivery // добавляем в order полученные данные о доставке
 
-	payment, err := db.getPaymentByOrderUID(ctx, orderUID) // получаем связанные данные об оплате
+	payment, err := db.getPaymentByOrderUID(ctx, pool, orderUID, order.DateCreated) // получаем связанные данные об оплате
 	if err != nil {
 		return order, err
 	}
 	order.Payment = payment // добавляем в order полученные данные об оплате
 
-	items, err := db.getItemsByOrderUID(ctx, orderUID) // получаем связанные данные о товарах
+	items, err := db.getItemsByOrderUID(ctx, pool, orderUID, order.DateCreated) // получаем связанные данные о товарах
 	if err != nil {
 		return order, err
 	}
@@ -64,15 +99,15 @@ func (db *DB) GetOrder(ctx context.Context, orderUID string) (model.Order, error
 
 // функция для получения delivery по order_uid
 // возвращаемое значение: экземпляр структуры Delivery и ошибку, если delivery не найден
-func (db *DB) getDeliveryByOrderUID(ctx context.Context, orderUID string) (model.Delivery, error) {
+func (db *DB) getDeliveryByOrderUID(ctx context.Context, pool *pgxpool.Pool, orderUID string, dateCreated time.Time) (model.Delivery, error) {
 	var delivery model.Delivery // объявляем экземпляр структуры Delivery
 
 	// получаем основную информацию о доставке
-	row := db.Pool.QueryRow(ctx, `
+	row := pool.QueryRow(ctx, `
 	SELECT name, phone, zip, city, address, region, email
 	FROM delivery
-	WHERE order_uid = $1
-	`, orderUID)
+	WHERE order_uid = $1 AND date_created = $2
+	`, orderUID, dateCreated)
 
 	// заполняем наш экземпляр delivery полученными значениями
 	err := row.Scan(
@@ -97,15 +132,15 @@ func (db *DB) getDeliveryByOrderUID(ctx context.Context, orderUID string) (model
 
 // функция для получения payment по order_uid
 // возвращаемое значение: экземпляр структуры Payment и ошибку, если payment не найден
-func (db *DB) getPaymentByOrderUID(ctx context.Context, orderUID string) (model.Payment, error) {
+func (db *DB) getPaymentByOrderUID(ctx context.Context, pool *pgxpool.Pool, orderUID string, dateCreated time.Time) (model.Payment, error) {
 	var payment model.Payment // объявляем экземпляр структуры Payment
 
 	// получаем основную информацию об оплате
-	row := db.Pool.QueryRow(ctx, `
+	row := pool.QueryRow(ctx, `
 	SELECT transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
 	FROM payment
-	WHERE order_uid = $1
-	`, orderUID)
+	WHERE order_uid = $1 AND date_created = $2
+	`, orderUID, dateCreated)
 
 	// заполняем наш экземпляр payment полученными значениями
 	err := row.Scan(
@@ -132,19 +167,20 @@ func (db *DB) getPaymentByOrderUID(ctx context.Context, orderUID string) (model.
 
 // функция для получения items по order_uid
 // возвращаемое значение: слайс экземпляров структуры Item и ошибку, если items не найдены
-func (db *DB) getItemsByOrderUID(ctx context.Context, orderUID string) ([]model.Item, error) {
+func (db *DB) getItemsByOrderUID(ctx context.Context, pool *pgxpool.Pool, orderUID string, dateCreated time.Time) ([]model.Item, error) {
 	var items []model.Item // объявляем слайс экземпляров структуры Item
 
 	// получаем основную информацию о товарах
-	rows, err := db.Pool.Query(ctx, `
+	rows, err := pool.Query(ctx, `
 		SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
 		FROM items
-		WHERE order_uid = $1
-	`, orderUID)
+		WHERE order_uid = $1 AND date_created = $2
+	`, orderUID, dateCreated)
 
 	// логгируем и возвращаем ошибку, если таковая есть
 	if err != nil {
 		log.Printf("[DB] Ошибка получения items для заказа %s: %v", orderUID, err)
+		return nil, err
 	}
 
 	// закрываем соединение с БД
@@ -184,7 +220,8 @@ func (db *DB) GetAllOrders(ctx context.Context) ([]model.Order, error) {
 	var orders []model.Order // объявляем слайс экземпляров структуры Order
 
 	// получаем все заказы из таблицы orders
-	rows, err := db.Pool.Query(ctx, `
+	pool, _ := db.readPool("")
+	rows, err := pool.Query(ctx, `
 		SELECT order_uid FROM orders
 	`)
 	if err != nil {
@@ -213,3 +250,166 @@ func (db *DB) GetAllOrders(ctx context.Context) ([]model.Order, error) {
 	return orders, nil
 
 }
+
+// структура ключа заказа: order_uid и date_created (ключ партиции)
+type orderKey struct {
+	OrderUID    string
+	DateCreated time.Time
+}
+
+// функция для создания ключа заказа
+// время приводится к UTC, чтобы ключи, полученные из БД и из курсора, совпадали при сравнении
+func newOrderKey(orderUID string, dateCreated time.Time) orderKey {
+	return orderKey{OrderUID: orderUID, DateCreated: dateCreated.UTC()}
+}
+
+// функция для выполнения нескольких запросов чтения в одном снимке данных
+// запросы выполняются в read-only транзакции REPEATABLE READ на реплике, если она доступна, поэтому видят одно состояние БД;
+// при ошибке реплики чтение повторяется на primary
+// возвращаемое значение: ошибка, если чтение не выполнено
+func (db *DB) readSnapshot(ctx context.Context, read func(tx pgx.Tx) error) error {
+	pool, replica := db.readPool("")
+	err := readSnapshotFrom(ctx, pool, read)
+	if err != nil && replica != nil && ctx.Err() == nil {
+		replica.markUnhealthy(err) // реплика недоступна - не используем ее до следующей проверки
+		err = readSnapshotFrom(ctx, db.Pool, read)
+	}
+	return err
+}
+
+// функция для выполнения запросов чтения в одной транзакции указанного пула
+// возвращаемое значение: ошибка, если чтение не выполнено
+func readSnapshotFrom(ctx context.Context, pool *pgxpool.Pool, read func(tx pgx.Tx) error) error {
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		log.Printf("[DB] Ошибка при создании транзакции: %v", err)
+		return err
+	}
+	defer tx.Rollback(ctx) // транзакция только читает, откат после Commit ничего не делает
+
+	if err := read(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// функция для загрузки нескольких заказов вместе с delivery, payment и items
+// каждая таблица читается одним запросом по набору order_uid с фильтром по date_created, поэтому затрагиваются только нужные партиции;
+// заказы, удаленные после получения ключей (например, перенесенные в архив) или оставшиеся без delivery/payment, пропускаются
+// возвращаемое значение: заказы в порядке ключей и ошибка, если данные не получены
+func loadOrders(ctx context.Context, tx pgx.Tx, keys []orderKey) ([]model.Order, error) {
+	orderUIDs := make([]string, len(keys))
+	dates := make([]time.Time, len(keys))
+	for i, key := range keys {
+		orderUIDs[i], dates[i] = key.OrderUID, key.DateCreated
+	}
+
+	// фильтр по двум массивам шире набора пар (order_uid, date_created), поэтому лишние строки отбрасываются по ключу
+	orders := make(map[orderKey]*model.Order, len(keys))
+	var order model.Order
+	rows, err := tx.Query(ctx, `
+		SELECT order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, status
+		FROM orders
+		WHERE order_uid = ANY($1) AND date_created = ANY($2)
+	`, orderUIDs, dates)
+	if err == nil {
+		_, err = pgx.ForEachRow(rows, []any{
+			&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature, &order.CustomerID,
+			&order.DeliveryService, &order.ShardKey, &order.SmID, &order.DateCreated, &order.OofShard, &order.Status,
+		}, func() error {
+			loaded := order
+			orders[newOrderKey(loaded.OrderUID, loaded.DateCreated)] = &loaded
+			return nil
+		})
+	}
+	if err != nil {
+		log.Printf("[DB] Ошибка получения заказов: %v", err)
+		return nil, err
+	}
+
+	hasDelivery := make(map[orderKey]bool, len(orders))
+	var orderUID string
+	var dateCreated time.Time
+	var delivery model.Delivery
+	rows, err = tx.Query(ctx, `
+		SELECT order_uid, date_created, name, phone, zip, city, address, region, email
+		FROM delivery
+		WHERE order_uid = ANY($1) AND date_created = ANY($2)
+	`, orderUIDs, dates)
+	if err == nil {
+		_, err = pgx.ForEachRow(rows, []any{
+			&orderUID, &dateCreated, &delivery.Name, &delivery.Phone, &delivery.Zip, &delivery.City, &delivery.Address, &delivery.Region, &delivery.Email,
+		}, func() error {
+			key := newOrderKey(orderUID, dateCreated)
+			if o, ok := orders[key]; ok {
+				o.Delivery, hasDelivery[key] = delivery, true
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		log.Printf("[DB] Ошибка получения delivery заказов: %v", err)
+		return nil, err
+	}
+
+	hasPayment := make(map[orderKey]bool, len(orders))
+	var payment model.Payment
+	rows, err = tx.Query(ctx, `
+		SELECT order_uid, date_created, transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
+		FROM payment
+		WHERE order_uid = ANY($1) AND date_created = ANY($2)
+	`, orderUIDs, dates)
+	if err == nil {
+		_, err = pgx.ForEachRow(rows, []any{
+			&orderUID, &dateCreated, &payment.Transaction, &payment.RequestID, &payment.Currency, &payment.Provider, &payment.Amount,
+			&payment.PaymentDT, &payment.Bank, &payment.DeliveryCost, &payment.GoodsTotal, &payment.CustomFee,
+		}, func() error {
+			key := newOrderKey(orderUID, dateCreated)
+			if o, ok := orders[key]; ok {
+				o.Payment, hasPayment[key] = payment, true
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		log.Printf("[DB] Ошибка получения payment заказов: %v", err)
+		return nil, err
+	}
+
+	var item model.Item
+	rows, err = tx.Query(ctx, `
+		SELECT order_uid, date_created, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
+		FROM items
+		WHERE order_uid = ANY($1) AND date_created = ANY($2)
+		ORDER BY id
+	`, orderUIDs, dates)
+	if err == nil {
+		_, err = pgx.ForEachRow(rows, []any{
+			&orderUID, &dateCreated, &item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid, &item.Name, &item.Sale,
+			&item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status,
+		}, func() error {
+			if o, ok := orders[newOrderKey(orderUID, dateCreated)]; ok {
+				o.Items = append(o.Items, item)
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		log.Printf("[DB] Ошибка получения items заказов: %v", err)
+		return nil, err
+	}
+
+	result := make([]model.Order, 0, len(keys))
+	for _, key := range keys {
+		o, ok := orders[key]
+		switch {
+		case !ok:
+			log.Printf("[DB] Заказ %s удален после получения списка, пропускаем", key.OrderUID)
+		case !hasDelivery[key] || !hasPayment[key]:
+			log.Printf("[DB] У заказа %s нет delivery или payment, пропускаем", key.OrderUID)
+		default:
+			result = append(result, *o)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"wb-tech-test/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ошибка, возвращаемая при некорректном курсоре пагинации
+var ErrInvalidCursor = errors.New("некорректный курсор пагинации")
+
+// ошибка, возвращаемая при размере страницы вне диапазона [1, MaxListLimit]
+var ErrInvalidLimit = errors.New("некорректный размер страницы")
+
+// максимальное количество заказов на странице списка
+const MaxListLimit = 100
+
+// структура для фильтров списка заказов
+// пустые поля не участвуют в фильтрации
+type OrderFilter struct {
+	CustomerID      string    // идентификатор покупателя
+	DeliveryService string    // служба доставки
+	Locale          string    // локаль заказа
+	Currency        string    // валюта оплаты
+	From            time.Time // начало диапазона дат создания (включительно)
+	To              time.Time // конец диапазона дат создания (не включительно)
+}
+
+// структура для страницы списка заказов
+type OrderPage struct {
+	Orders     []model.Order `json:"orders"`
+	NextCursor string        `json:"next_cursor,omitempty"` // пустой, если следующей страницы нет
+}
+
+// структура для позиции в списке заказов, закодированной в курсоре
+type orderCursor struct {
+	DateCreated time.Time `json:"d"`
+	OrderUID    string    `json:"u"`
+}
+
+// функция для получения страницы списка заказов от новых к старым
+// используется keyset-пагинация по (date_created, order_uid): курсор указывает на последний заказ предыдущей страницы;
+// заказы, удаленные между запросами (например, перенесенные в архив), в страницу не попадают
+// возвращаемое значение: страница заказов и ошибка (ErrInvalidCursor, если курсор некорректен, ErrInvalidLimit, если limit вне [1, MaxListLimit])
+func (db *DB) ListOrders(ctx context.Context, filter OrderFilter, cursor string, limit int) (OrderPage, error) {
+	var page OrderPage
+	if limit < 1 || limit > MaxListLimit {
+		return page, fmt.Errorf("%w: %d", ErrInvalidLimit, limit)
+	}
+
+	conditions := []string{"TRUE"}
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.CustomerID != "" {
+		conditions = append(conditions, "o.customer_id = "+arg(filter.CustomerID))
+	}
+	if filter.DeliveryService != "" {
+		conditions = append(conditions, "o.delivery_service = "+arg(filter.DeliveryService))
+	}
+	if filter.Locale != "" {
+		conditions = append(conditions, "o.locale = "+arg(filter.Locale))
+	}
+	if filter.Currency != "" {
+		conditions = append(conditions, "p.currency = "+arg(filter.Currency))
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "o.date_created >= "+arg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "o.date_created < "+arg(filter.To))
+	}
+	if cursor != "" {
+		position, err := decodeCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+		conditions = append(conditions, fmt.Sprintf("(o.date_created, o.order_uid) < (%s, %s)", arg(position.DateCreated), arg(position.OrderUID)))
+	}
+
+	// join с payment нужен только для фильтра по валюте
+	join := ""
+	if filter.Currency != "" {
+		join = "JOIN payment p ON p.order_uid = o.order_uid AND p.date_created = o.date_created"
+	}
+
+	// запрашиваем на один заказ больше, чтобы понять, есть ли следующая страница
+	query := fmt.Sprintf(`
+		SELECT o.order_uid, o.date_created
+		FROM orders o %s
+		WHERE %s
+		ORDER BY o.date_created DESC, o.order_uid DESC
+		LIMIT %s
+	`, join, strings.Join(conditions, " AND "), arg(limit+1))
+
+	// страница и данные ее заказов читаются в одном снимке, поэтому реплика не может отстать между запросами
+	err := db.readSnapshot(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, query, args...)
+		if err != nil {
+			log.Printf("[DB] Ошибка получения списка заказов: %v", err)
+			return err
+		}
+
+		keys, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (orderKey, error) {
+			var key orderKey
+			err := row.Scan(&key.OrderUID, &key.DateCreated)
+			return newOrderKey(key.OrderUID, key.DateCreated), err
+		})
+		if err != nil {
+			log.Printf("[DB] Ошибка сканирования списка заказов: %v", err)
+			return err
+		}
+
+		page.NextCursor = ""
+		if len(keys) > limit {
+			keys = keys[:limit]
+			last := keys[len(keys)-1]
+			page.NextCursor = encodeCursor(orderCursor{DateCreated: last.DateCreated, OrderUID: last.OrderUID})
+		}
+
+		page.Orders, err = loadOrders(ctx, tx, keys)
+		return err
+	})
+	if err != nil {
+		return OrderPage{}, err
+	}
+	return page, nil
+}
+
+// функция для кодирования позиции в списке заказов в непрозрачный курсор
+// возвращаемое значение: курсор в виде base64-строки
+func encodeCursor(position orderCursor) string {
+	data, _ := json.Marshal(position)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// функция для декодирования курсора в позицию в списке заказов
+// возвращаемое значение: позиция и ErrInvalidCursor, если курсор некорректен
+func decodeCursor(cursor string) (orderCursor, error) {
+	var position orderCursor
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return position, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &position); err != nil || position.OrderUID == "" {
+		return position, ErrInvalidCursor
+	}
+	return position, nil
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	want := orderCursor{
+		DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 123456000, time.FixedZone("MSK", 3*60*60)),
+		OrderUID:    "b563feb7b2b84b6test",
+	}
+
+	got, err := decodeCursor(encodeCursor(want))
+	if err != nil {
+		t.Fatalf("decodeCursor: %v", err)
+	}
+	if got.OrderUID != want.OrderUID || !got.DateCreated.Equal(want.DateCreated) {
+		t.Errorf("позиция после декодирования %+v, ожидается %+v", got, want)
+	}
+}
+
+func TestDecodeCursorRejectsTampered(t *testing.T) {
+	valid := encodeCursor(orderCursor{DateCreated: time.Now(), OrderUID: "b563feb7b2b84b6test"})
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"не base64", "!!!"},
+		{"base64 с дополнением", valid + "=="},
+		{"обрезанный курсор", valid[:len(valid)/2]},
+		{"не JSON", base64.RawURLEncoding.EncodeToString([]byte("order"))},
+		{"некорректная дата", base64.RawURLEncoding.EncodeToString([]byte(`{"d":"вчера","u":"x"}`))},
+		{"без order_uid", base64.RawURLEncoding.EncodeToString([]byte(`{"d":"2021-11-26T06:22:19Z"}`))},
+		{"order_uid другого типа", base64.RawURLEncoding.EncodeToString([]byte(`{"d":"2021-11-26T06:22:19Z","u":1}`))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("decodeCursor(%q): ошибка %v, ожидается ErrInvalidCursor", tt.cursor, err)
+			}
+		})
+	}
+}
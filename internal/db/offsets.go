@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// структура для описания исходного сообщения Kafka, из которого получен заказ
+type SourceMessage struct {
+	Topic     string    // топик сообщения
+	Partition int       // партиция сообщения
+	Offset    int64     // смещение сообщения в партиции
+	Key       []byte    // ключ сообщения
+	Value     []byte    // тело сообщения
+	Time      time.Time // время сообщения в Kafka
+
+	ContentType string // формат тела сообщения (пустой - JSON)
+
+	// смещение сохраняется отдельно через SaveKafkaOffset, а не в транзакции заказа
+	// (при параллельной обработке смещение сдвигается только после обработки всех предыдущих сообщений)
+	DeferOffset bool
+}
+
+// запрос для сохранения следующего смещения партиции
+const upsertKafkaOffsetQuery = `
+	INSERT INTO kafka_offsets (topic, partition, next_offset, updated_at)
+	VALUES ($1,$2,$3,now())
+	ON CONFLICT (topic, partition) DO UPDATE
+	SET next_offset = EXCLUDED.next_offset, updated_at = EXCLUDED.updated_at
+`
+
+// функция для получения сохраненных смещений по всем партициям топика
+// возвращаемое значение: мапа партиция -> следующее смещение для чтения и ошибка, если смещения не получены
+func (db *DB) GetKafkaOffsets(ctx context.Context, topic string) (map[int]int64, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT partition, next_offset FROM kafka_offsets WHERE topic = $1
+	`, topic)
+	if err != nil {
+		log.Printf("[DB] Ошибка получения смещений для топика %s: %v", topic, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	offsets := make(map[int]int64)
+	for rows.Next() {
+		var partition int
+		var offset int64
+		if err := rows.Scan(&partition, &offset); err != nil {
+			log.Printf("[DB] Ошибка сканирования смещения для топика %s: %v", topic, err)
+			return nil, err
+		}
+		offsets[partition] = offset
+	}
+	return offsets, rows.Err()
+}
+
+// функция для сохранения смещения сообщения без сохранения заказа
+// используется для сообщений, которые не могут быть сохранены (например, некорректный JSON или дубликат)
+// возвращаемое значение: ошибка, если смещение не сохранено
+func (db *DB) SaveKafkaOffset(ctx context.Context, source SourceMessage) error {
+	_, err := db.Pool.Exec(ctx, upsertKafkaOffsetQuery, source.Topic, source.Partition, source.Offset+1)
+	if err != nil {
+		log.Printf("[DB] Ошибка сохранения смещения %d для %s/%d: %v", source.Offset, source.Topic, source.Partition, err)
+	}
+	return err
+}
+
+// функция для сохранения смещения сообщения в рамках транзакции сохранения заказа
+// возвращаемое значение: ошибка, если смещение не сохранено
+func (db *DB) saveKafkaOffset(ctx context.Context, tx pgx.Tx, source SourceMessage) error {
+	_, err := tx.Exec(ctx, upsertKafkaOffsetQuery, source.Topic, source.Partition, source.Offset+1)
+	if err != nil {
+		log.Printf("[DB] Ошибка сохранения смещения %d для %s/%d: %v", source.Offset, source.Topic, source.Partition, err)
+	}
+	return err
+}
@@ -0,0 +1,169 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+	"wb-tech-test/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// тип события о сохранении нового заказа
+const OrderCreatedEvent = "order.created"
+
+// максимальная задержка перед повторной отправкой события
+const maxOutboxBackoff = 5 * time.Minute
+
+// ошибка для события, которое не отправлялось в этой пачке; такое событие не отмечается и выбирается повторно
+var ErrOutboxEventSkipped = errors.New("событие не отправлялось")
+
+// структура для события из таблицы outbox
+type OutboxEvent struct {
+	ID        int64     // идентификатор события
+	OrderUID  string    // UID заказа, к которому относится событие
+	EventType string    // тип события
+	Payload   []byte    // содержимое события в формате JSON
+	Attempts  int       // количество неудачных попыток отправки
+	CreatedAt time.Time // время создания события
+}
+
+// функция для записи события о заказе в таблицу outbox в рамках транзакции сохранения заказа
+// возвращаемое значение: ошибка, если событие не сохранено
+func (db *DB) insertOutboxEvent(ctx context.Context, tx pgx.Tx, order model.Order) error {
+	payload, err := json.Marshal(order)
+	if err != nil {
+		log.Printf("[DB] Ошибка маршалинга события для заказа %s: %v", order.OrderUID, err)
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO outbox (order_uid, event_type, payload)
+		VALUES ($1,$2,$3)
+	`, order.OrderUID, OrderCreatedEvent, payload)
+	if err != nil {
+		// логгируем и возвращаем ошибку, если таковая есть
+		log.Printf("[DB] Ошибка сохранения события для заказа %s в таблицу outbox: %v", order.OrderUID, err)
+		return err
+	}
+
+	log.Printf("[DB] Событие %s для заказа %s сохранено в outbox", OrderCreatedEvent, order.OrderUID)
+	return nil
+}
+
+// функция для отправки пачки неотправленных событий из таблицы outbox
+// события выбираются с блокировкой (FOR UPDATE SKIP LOCKED) и отмечаются в той же транзакции,
+// поэтому несколько ретрансляторов не отправляют одно событие дважды.
+// Для каждого заказа выбирается только самое раннее неотправленное событие, поэтому следующее событие заказа
+// не отправится, пока не отправлено предыдущее. send возвращает ошибку отправки для каждого события (nil - отправлено)
+// возвращаемое значение: количество отправленных событий и ошибка, если события не получены или не отмечены
+func (db *DB) RelayOutboxEvents(ctx context.Context, limit int, send func(ctx context.Context, events []OutboxEvent) []error) (int, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		log.Printf("[DB] Ошибка при создании транзакции outbox: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	events, err := pendingOutboxEvents(ctx, tx, limit)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	sent := 0
+	for i, sendErr := range send(ctx, events) {
+		if errors.Is(sendErr, ErrOutboxEventSkipped) {
+			continue
+		}
+		if sendErr != nil {
+			err = markOutboxEventFailed(ctx, tx, events[i], sendErr)
+		} else {
+			err = markOutboxEventSent(ctx, tx, events[i].ID)
+			sent++
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		log.Printf("[DB] Ошибка фиксации транзакции outbox: %v", err)
+		return 0, err
+	}
+	return sent, nil
+}
+
+// функция для получения неотправленных событий из таблицы outbox с блокировкой строк
+// события, заблокированные другим ретранслятором, пропускаются
+// возвращаемое значение: слайс событий и ошибка, если события не получены
+func pendingOutboxEvents(ctx context.Context, tx pgx.Tx, limit int) ([]OutboxEvent, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT o.id, o.order_uid, o.event_type, o.payload, o.attempts, o.created_at
+		FROM outbox o
+		WHERE o.sent_at IS NULL
+		  AND o.next_attempt_at <= now()
+		  AND NOT EXISTS (
+			SELECT 1 FROM outbox p
+			WHERE p.order_uid = o.order_uid AND p.sent_at IS NULL AND p.id < o.id
+		  )
+		ORDER BY o.id
+		LIMIT $1
+		FOR UPDATE OF o SKIP LOCKED
+	`, limit)
+	if err != nil {
+		log.Printf("[DB] Ошибка получения событий из outbox: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []OutboxEvent
+	for rows.Next() {
+		var event OutboxEvent
+		if err := rows.Scan(&event.ID, &event.OrderUID, &event.EventType, &event.Payload, &event.Attempts, &event.CreatedAt); err != nil {
+			log.Printf("[DB] Ошибка сканирования события из outbox: %v", err)
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// функция для отметки события как отправленного
+// возвращаемое значение: ошибка, если событие не обновлено
+func markOutboxEventSent(ctx context.Context, tx pgx.Tx, id int64) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE outbox SET sent_at = now(), last_error = NULL WHERE id = $1
+	`, id)
+	if err != nil {
+		log.Printf("[DB] Ошибка отметки события %d как отправленного: %v", id, err)
+	}
+	return err
+}
+
+// функция для отметки неудачной попытки отправки события
+// следующая попытка откладывается с экспоненциально растущей задержкой
+// возвращаемое значение: ошибка, если событие не обновлено
+func markOutboxEventFailed(ctx context.Context, tx pgx.Tx, event OutboxEvent, sendErr error) error {
+	delay := outboxBackoff(event.Attempts + 1)
+	_, err := tx.Exec(ctx, `
+		UPDATE outbox
+		SET attempts = attempts + 1, last_error = $2, next_attempt_at = now() + $3 * interval '1 second'
+		WHERE id = $1
+	`, event.ID, sendErr.Error(), int(delay.Seconds()))
+	if err != nil {
+		log.Printf("[DB] Ошибка отметки неудачной отправки события %d: %v", event.ID, err)
+	}
+	return err
+}
+
+// функция для расчета задержки перед повторной отправкой события
+// возвращаемое значение: задержка, удваивающаяся с каждой попыткой, но не больше maxOutboxBackoff
+func outboxBackoff(attempts int) time.Duration {
+	delay := time.Second
+	for i := 1; i < attempts && delay < maxOutboxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxOutboxBackoff)
+}
@@ -0,0 +1,193 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// формат границы партиции (начало месяца в UTC)
+const partitionBoundLayout = "2006-01-02 00:00:00+00"
+
+// таблицы, секционированные по месяцам по столбцу date_created
+// orders идет первой, так как остальные таблицы ссылаются на нее
+var partitionedTables = []string{"orders", "delivery", "payment", "items"}
+
+// функция для создания месячных партиций для всех секционированных таблиц
+// создаются партиции для месяца from и следующих monthsAhead месяцев;
+// ошибка одного месяца не мешает созданию партиций остальных месяцев
+// возвращаемое значение: ошибка, если хотя бы одна партиция не создана
+func (db *DB) EnsurePartitions(ctx context.Context, from time.Time, monthsAhead int) error {
+	month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC) // начало месяца
+	var errs []error
+	for i := 0; i <= monthsAhead; i++ {
+		start := month.AddDate(0, i, 0)
+		if err := db.createPartitions(ctx, start, start.AddDate(0, 1, 0)); err != nil {
+			log.Printf("[DB] Ошибка создания партиций за %s: %v", start.Format("2006-01"), err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// функция для периодического создания партиций на ближайшие месяцы
+// работает до отмены контекста
+func (db *DB) RunPartitionMaintenance(ctx context.Context, interval time.Duration, monthsAhead int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := db.EnsurePartitions(ctx, time.Now(), monthsAhead); err != nil {
+				log.Printf("[DB] Ошибка при создании партиций: %v", err)
+			}
+		}
+	}
+}
+
+// функция для создания партиций всех секционированных таблиц на диапазон [start, end)
+// строки этого диапазона, уже попавшие в партиции по умолчанию (заказ из будущего месяца или простой сервиса
+// на границе месяцев), переносятся в новые партиции, иначе Postgres отклонит создание партиции.
+// Партицию по умолчанию orders нельзя отсоединить, пока на ее строки ссылаются delivery, payment и items,
+// поэтому строки переносятся через временные таблицы в одной транзакции
+// возвращаемое значение: ошибка, если партиции не созданы
+func (db *DB) createPartitions(ctx context.Context, start, end time.Time) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var missing []string // таблицы без партиции на этот месяц, в порядке partitionedTables
+	for _, table := range partitionedTables {
+		exists, err := relationExists(ctx, tx, partitionName(table, start))
+		if err != nil {
+			return err
+		}
+		if !exists {
+			missing = append(missing, table)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	// блокируем запись в партиции по умолчанию, чтобы новые строки диапазона не появились во время переноса
+	var moved []string // таблицы, строки которых переносятся из партиции по умолчанию
+	for _, table := range missing {
+		exists, err := relationExists(ctx, tx, table+"_default")
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE`, pgx.Identifier{table + "_default"}.Sanitize())); err != nil {
+			return err
+		}
+		moved = append(moved, table)
+	}
+
+	columns := make(map[string]string, len(moved))
+	for _, table := range moved {
+		if columns[table], err = insertableColumns(ctx, tx, table); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, fmt.Sprintf(
+			`CREATE TEMP TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WHERE date_created >= '%s' AND date_created < '%s'`,
+			pgx.Identifier{"partition_move_" + table}.Sanitize(),
+			columns[table],
+			pgx.Identifier{table + "_default"}.Sanitize(),
+			start.Format(partitionBoundLayout),
+			end.Format(partitionBoundLayout),
+		))
+		if err != nil {
+			return fmt.Errorf("копирование строк %s_default: %w", table, err)
+		}
+	}
+
+	// строки удаляются в обратном порядке, чтобы не нарушить внешние ключи на orders
+	for i := len(moved) - 1; i >= 0; i-- {
+		table := moved[i]
+		_, err := tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE date_created >= $1 AND date_created < $2`,
+			pgx.Identifier{table + "_default"}.Sanitize()), start, end)
+		if err != nil {
+			return fmt.Errorf("удаление строк %s_default: %w", table, err)
+		}
+	}
+
+	for _, table := range missing {
+		if err := createPartition(ctx, tx, table, start, end); err != nil {
+			return err
+		}
+	}
+
+	for _, table := range moved {
+		tag, err := tx.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s FROM %s`,
+			pgx.Identifier{table}.Sanitize(),
+			columns[table],
+			columns[table],
+			pgx.Identifier{"partition_move_" + table}.Sanitize(),
+		))
+		if err != nil {
+			return fmt.Errorf("перенос строк в партицию %s: %w", partitionName(table, start), err)
+		}
+		if tag.RowsAffected() > 0 {
+			log.Printf("[DB] Из %s_default в %s перенесено строк: %d", table, partitionName(table, start), tag.RowsAffected())
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// функция для создания одной партиции таблицы на диапазон [start, end)
+// границы партиций задаются в UTC независимо от часового пояса сессии
+// возвращаемое значение: ошибка, если партиция не создана
+func createPartition(ctx context.Context, tx pgx.Tx, table string, start, end time.Time) error {
+	name := partitionName(table, start)
+	_, err := tx.Exec(ctx, fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')`,
+		pgx.Identifier{name}.Sanitize(),
+		pgx.Identifier{table}.Sanitize(),
+		start.Format(partitionBoundLayout),
+		end.Format(partitionBoundLayout),
+	))
+	if err != nil {
+		return fmt.Errorf("создание партиции %s: %w", name, err)
+	}
+	return nil
+}
+
+// функция для проверки существования таблицы в текущей схеме
+// возвращаемое значение: true, если таблица существует, и ошибка, если проверка не выполнена
+func relationExists(ctx context.Context, tx pgx.Tx, name string) (bool, error) {
+	var exists bool
+	err := tx.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, pgx.Identifier{name}.Sanitize()).Scan(&exists)
+	return exists, err
+}
+
+// функция для получения списка столбцов таблицы, в которые можно вставлять значения
+// генерируемые столбцы (например, items.search_vector) исключаются
+// возвращаемое значение: список столбцов через запятую и ошибка, если список не получен
+func insertableColumns(ctx context.Context, tx pgx.Tx, table string) (string, error) {
+	var columns string
+	err := tx.QueryRow(ctx, `
+		SELECT string_agg(quote_ident(column_name), ', ' ORDER BY ordinal_position)
+		FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1 AND is_generated = 'NEVER'
+	`, table).Scan(&columns)
+	return columns, err
+}
+
+// функция для получения имени месячной партиции таблицы
+// возвращаемое значение: имя партиции, например orders_y2025m07
+func partitionName(table string, month time.Time) string {
+	return fmt.Sprintf("%s_y%04dm%02d", table, month.Year(), int(month.Month()))
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+	"wb-tech-test/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// формат тела сообщения по умолчанию
+const contentTypeJSON = "application/json"
+
+// функция для получения тела сообщения в виде для сохранения
+// JSON сохраняется как есть; для двоичных форматов в payload записывается декодированный заказ, а исходное тело - в binary
+// возвращаемое значение: формат, тело в JSON, исходное двоичное тело (nil для JSON) и ошибка, если заказ не сериализован
+func (source SourceMessage) Payloads(order model.Order) (contentType string, payload, binary []byte, err error) {
+	if source.ContentType == "" || source.ContentType == contentTypeJSON {
+		return contentTypeJSON, source.Value, nil, nil
+	}
+	payload, err = json.Marshal(order)
+	return source.ContentType, payload, source.Value, err
+}
+
+// функция для сохранения исходного сообщения Kafka в рамках транзакции сохранения заказа
+// возвращаемое значение: ошибка, если сообщение не сохранено
+func (db *DB) insertRawMessage(ctx context.Context, tx pgx.Tx, order model.Order, source SourceMessage) error {
+	orderUID := order.OrderUID
+	var messageTime any // у сообщения может не быть времени
+	if !source.Time.IsZero() {
+		messageTime = source.Time
+	}
+
+	contentType, payload, binary, err := source.Payloads(order)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO raw_messages (order_uid, topic, partition, "offset", key, payload, message_time, content_type, payload_binary)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+	`, orderUID, source.Topic, source.Partition, source.Offset, source.Key, string(payload), messageTime, contentType, binary)
+	if err != nil {
+		// логгируем и возвращаем ошибку, если таковая есть
+		log.Printf("[DB] Ошибка сохранения исходного сообщения для заказа %s: %v", orderUID, err)
+		return err
+	}
+	return nil
+}
+
+// функция для получения исходного сообщения Kafka, из которого был сохранен заказ
+// возвращаемое значение: исходное сообщение и ошибка (pgx.ErrNoRows, если сообщение не найдено)
+func (db *DB) GetRawMessage(ctx context.Context, orderUID string) (model.RawMessage, error) {
+	var raw model.RawMessage
+	var key []byte
+	var messageTime *time.Time
+	err := db.Pool.QueryRow(ctx, `
+		SELECT order_uid, topic, partition, "offset", key, payload, message_time, received_at, content_type, payload_binary
+		FROM raw_messages
+		WHERE order_uid = $1
+	`, orderUID).Scan(&raw.OrderUID, &raw.Topic, &raw.Partition, &raw.Offset, &key, &raw.Payload, &messageTime, &raw.ReceivedAt, &raw.ContentType, &raw.PayloadBinary)
+	if err != nil {
+		log.Printf("[DB] Ошибка получения исходного сообщения для заказа %s: %v", orderUID, err)
+		return raw, err
+	}
+
+	raw.Key = string(key)
+	if messageTime != nil {
+		raw.MessageTime = *messageTime
+	}
+	return raw, nil
+}
@@ -0,0 +1,198 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	replicaCheckTimeout = 2 * time.Second  // таймаут проверки доступности реплики
+	replicaMaxLag       = 10 * time.Second // максимальное отставание реплики, при котором с нее еще читаем
+	readYourWritesTTL   = 30 * time.Second // время, в течение которого заказ после сохранения читается с primary
+)
+
+// ошибка, возвращаемая при отставании реплики больше допустимого
+var errReplicaLag = errors.New("реплика отстает от primary")
+
+// структура для реплики БД, используемой для чтения
+type replica struct {
+	pool    *pgxpool.Pool // пул соединений с репликой
+	healthy atomic.Bool   // флаг доступности реплики по результатам последней проверки
+}
+
+// структура для учета недавно сохраненных заказов
+// такие заказы читаются с primary, так как могли еще не дойти до реплик
+type recentWrites struct {
+	mu          sync.Mutex           // для безопасного доступа к мапе
+	orders      map[string]time.Time // ключ - orderUID, значение - время сохранения
+	lastCleanup time.Time            // время последнего удаления устаревших записей
+}
+
+// функция для создания пулов соединений с репликами по списку строк подключения через запятую
+// реплики, к которым не удалось подключиться, пропускаются
+// возвращаемое значение: слайс реплик
+func newReplicas(dsns string) []*replica {
+	var replicas []*replica
+	for _, dsn := range strings.Split(dsns, ",") {
+		dsn = strings.TrimSpace(dsn)
+		if dsn == "" {
+			continue
+		}
+		pool, err := pgxpool.New(context.Background(), dsn) // создание пула соединений с репликой
+		if err != nil {
+			log.Printf("[DB] Ошибка при создании пула для реплики: %v", err)
+			continue
+		}
+		r := &replica{pool: pool}
+		r.healthy.Store(true)
+		replicas = append(replicas, r)
+	}
+	return replicas
+}
+
+// функция для пометки реплики как недоступной до следующей проверки
+func (r *replica) markUnhealthy(err error) {
+	if r.healthy.Swap(false) {
+		log.Printf("[DB] Реплика %s недоступна, чтение переключено на primary: %v", r.pool.Config().ConnConfig.Host, err)
+	}
+}
+
+// функция для проверки доступности и отставания реплики
+// возвращаемое значение: ошибка, если реплика недоступна или отстает больше допустимого
+func (r *replica) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+	defer cancel()
+
+	// время последней воспроизведенной транзакции перестает меняться, когда на primary нет записи,
+	// поэтому реплика, воспроизведшая все полученные WAL, считается не отстающей
+	var lag float64 // отставание в секундах, 0 если реплика ничего не воспроизводила
+	err := r.pool.QueryRow(ctx, `
+		SELECT CASE
+			WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+			ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+		END
+	`).Scan(&lag)
+	if err != nil {
+		return err
+	}
+	if time.Duration(lag*float64(time.Second)) > replicaMaxLag {
+		return errReplicaLag
+	}
+	return nil
+}
+
+// функция для выбора пула для чтения заказа
+// недавно сохраненные заказы читаются с primary, остальные - с доступной реплики по кругу
+// возвращаемое значение: пул для чтения и реплика, которой он принадлежит (nil, если выбран primary)
+func (db *DB) readPool(orderUID string) (*pgxpool.Pool, *replica) {
+	if len(db.replicas) == 0 || (orderUID != "" && db.recent.contains(orderUID)) {
+		return db.Pool, nil
+	}
+
+	start := db.nextReplica.Add(1)
+	for i := range len(db.replicas) {
+		r := db.replicas[(int(start)+i)%len(db.replicas)]
+		if r.healthy.Load() {
+			return r.pool, r
+		}
+	}
+	return db.Pool, nil // все реплики недоступны - читаем с primary
+}
+
+// функция для периодической проверки реплик
+// недоступные реплики исключаются из чтения, восстановившиеся - возвращаются
+// работает до отмены контекста
+func (db *DB) RunReplicaHealthCheck(ctx context.Context, interval time.Duration) {
+	if len(db.replicas) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, r := range db.replicas {
+			if err := r.check(ctx); err != nil {
+				r.markUnhealthy(err)
+				continue
+			}
+			if !r.healthy.Swap(true) {
+				log.Printf("[DB] Реплика %s снова доступна", r.pool.Config().ConnConfig.Host)
+			}
+		}
+		db.recent.cleanup()
+	}
+}
+
+// функция для закрытия пулов соединений с primary и репликами
+func (db *DB) Close() {
+	for _, r := range db.replicas {
+		r.pool.Close()
+	}
+	db.Pool.Close()
+}
+
+// функция для создания учета недавно сохраненных заказов
+func newRecentWrites() *recentWrites {
+	return &recentWrites{orders: make(map[string]time.Time)}
+}
+
+// функция для отметки заказа как только что сохраненного
+// без реплик все заказы и так читаются с primary, поэтому заказ не запоминается
+func (db *DB) markRecent(orderUID string) {
+	if len(db.replicas) == 0 {
+		return
+	}
+	db.recent.add(orderUID)
+}
+
+// функция для отметки заказа как только что сохраненного
+// устаревшие записи удаляются не реже раза в readYourWritesTTL, поэтому мапа не растет без ограничений
+func (w *recentWrites) add(orderUID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	w.orders[orderUID] = now
+	if now.Sub(w.lastCleanup) >= readYourWritesTTL {
+		w.removeExpired(now)
+	}
+}
+
+// функция для проверки, был ли заказ сохранен недавно
+// возвращаемое значение: true, если заказ нужно читать с primary
+func (w *recentWrites) contains(orderUID string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	savedAt, ok := w.orders[orderUID]
+	return ok && time.Since(savedAt) < readYourWritesTTL
+}
+
+// функция для удаления устаревших записей о сохраненных заказах
+func (w *recentWrites) cleanup() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.removeExpired(time.Now())
+}
+
+// функция для удаления устаревших записей (вызывается под блокировкой)
+func (w *recentWrites) removeExpired(now time.Time) {
+	for orderUID, savedAt := range w.orders {
+		if now.Sub(savedAt) >= readYourWritesTTL {
+			delete(w.orders, orderUID)
+		}
+	}
+	w.lastCleanup = now
+}
@@ -2,16 +2,42 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 	"wb-tech-test/internal/model"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// количество товаров, начиная с которого items сохраняются через COPY вместо batch-запроса
+const copyItemsThreshold = 100
+
+// столбцы таблицы items, заполняемые при сохранении заказа
+var itemColumns = []string{"order_uid", "date_created", "chrt_id", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status"}
+
+// ошибка, возвращаемая при попытке повторно сохранить уже существующий заказ
+var ErrOrderExists = errors.New("заказ уже существует")
+
 // функция для сохранения заказа в БД
 // возвращаемое значение: ошибка, если заказ не сохранен
 func (db *DB) SaveOrder(ctx context.Context, order model.Order) error {
+	return db.saveOrder(ctx, order, nil)
+}
+
+// функция для сохранения заказа, полученного из Kafka
+// исходное сообщение и его смещение сохраняются в той же транзакции, что и заказ,
+// поэтому каждое сообщение применяется к БД ровно один раз
+// возвращаемое значение: ошибка, если заказ не сохранен
+func (db *DB) SaveOrderFromMessage(ctx context.Context, order model.Order, source SourceMessage) error {
+	return db.saveOrder(ctx, order, &source)
+}
+
+// функция для сохранения заказа и (если передано) исходного сообщения Kafka в одной транзакции
+// возвращаемое значение: ошибка, если заказ не сохранен
+func (db *DB) saveOrder(ctx context.Context, order model.Order, source *SourceMessage) (err error) {
 
 	tx, err := db.Pool.Begin(ctx) // создаем транзакцию
 	if err != nil {
@@ -25,51 +51,132 @@ func (db *DB) SaveOrder(ctx context.Context, order model.Order) error {
 		}
 	}()
 
+	// сохраняем заказ и связанные данные
+	if err = db.saveOrderTx(ctx, tx, order, source); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+	db.markRecent(order.OrderUID) // сразу после сохранения читаем заказ с primary
+	return nil
+}
+
+// функция для сохранения заказа, связанных данных и (если передано) исходного сообщения Kafka в рамках переданной транзакции
+// возвращаемое значение: ошибка, если заказ не сохранен
+func (db *DB) saveOrderTx(ctx context.Context, tx pgx.Tx, order model.Order, source *SourceMessage) error {
+	// первичный ключ партиций включает date_created, поэтому уникальность order_uid и транзакции оплаты
+	// обеспечивается проверками ниже; блокировки не дают параллельным сохранениям одного заказа пройти проверки одновременно
+	if err := lockOrder(ctx, tx, order); err != nil {
+		return err
+	}
+
 	// проверяем, существует ли транзакция в таблице payment
-	transactionExists, err := db.IsTransactionExists(ctx, order.Payment.Transaction)
+	// проверки выполняются в транзакции, чтобы видеть заказы, сохраненные ранее в том же пакете
+	transactionExists, err := isTransactionExists(ctx, tx, order.Payment.Transaction)
 	if err != nil {
 		return err
 	}
 
 	// если транзакция уже существует, то возвращаем ошибку
 	if transactionExists {
-		return fmt.Errorf("[DB] Payment транзакция %s уже существует", order.Payment.Transaction)
+		return fmt.Errorf("[DB] Payment транзакция %s уже существует: %w", order.Payment.Transaction, ErrOrderExists)
+	}
 
+	// проверяем, существует ли заказ с таким order_uid
+	// уникальность order_uid между партициями не обеспечивается ограничением БД, поэтому проверяем явно
+	orderExists, err := isOrderExists(ctx, tx, order.OrderUID)
+	if err != nil {
+		return err
+	}
+	if orderExists {
+		return fmt.Errorf("[DB] Заказ %s уже существует: %w", order.OrderUID, ErrOrderExists)
 	}
 
 	// сохраняем заказ в таблицу orders
-	if err := db.insertOrder(ctx, tx, order); err != nil {
+	if err = db.insertOrder(ctx, tx, order); err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("[DB] Заказ %s уже существует: %w", order.OrderUID, ErrOrderExists)
+		}
 		return err
 	}
 
 	// сохраняем delivery в таблицу delivery
-	if err := db.insertDelivery(ctx, tx, order.OrderUID, order.Delivery); err != nil {
+	if err = db.insertDelivery(ctx, tx, order.OrderUID, order.DateCreated, order.Delivery); err != nil {
 		return err
 	}
 
 	// сохраняем payment в таблицу payment
-	if err := db.insertPayment(ctx, tx, order.OrderUID, order.Payment); err != nil {
+	if err = db.insertPayment(ctx, tx, order.OrderUID, order.DateCreated, order.Payment); err != nil {
 		return err
 	}
 
 	// сохраняем items в таблицу items
-	if err := db.insertItems(ctx, tx, order.OrderUID, order.Items); err != nil {
+	if err = db.insertItems(ctx, tx, order.OrderUID, order.DateCreated, order.Items); err != nil {
 		return err
 	}
 
-	return tx.Commit(ctx)
+	// сохраняем первую запись в истории статусов заказа
+	if err = db.insertStatusChange(ctx, tx, &model.StatusChange{OrderUID: order.OrderUID, To: model.StatusCreated}); err != nil {
+		return err
+	}
+
+	// сохраняем событие о новом заказе в таблицу outbox
+	if err = db.insertOutboxEvent(ctx, tx, order); err != nil {
+		return err
+	}
+
+	// сохраняем исходное сообщение Kafka и его смещение
+	if source != nil {
+		if err = db.insertRawMessage(ctx, tx, order, *source); err != nil {
+			return err
+		}
+		if !source.DeferOffset {
+			if err = db.saveKafkaOffset(ctx, tx, *source); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// пространства ключей advisory-блокировок заказов
+const (
+	lockClassOrderUID    = 1 // блокировка по order_uid
+	lockClassTransaction = 2 // блокировка по транзакции оплаты
+)
+
+// функция для блокировки order_uid и транзакции оплаты заказа до конца транзакции БД
+// второе сохранение того же заказа ждет завершения первого и затем видит сохраненный заказ
+// возвращаемое значение: ошибка, если блокировка не получена
+func lockOrder(ctx context.Context, tx pgx.Tx, order model.Order) error {
+	_, err := tx.Exec(ctx, `
+		SELECT pg_advisory_xact_lock($1, hashtext($2)), pg_advisory_xact_lock($3, hashtext($4))
+	`, lockClassOrderUID, order.OrderUID, lockClassTransaction, order.Payment.Transaction)
+	if err != nil {
+		log.Printf("[DB] Ошибка блокировки заказа %s: %v", order.OrderUID, err)
+	}
+	return err
+}
+
+// функция для проверки, является ли ошибка нарушением ограничения уникальности
+// возвращаемое значение: true, если ошибка вызвана дублированием ключа
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
 }
 
 // функция для сохранения заказа в таблицу orders
 // возвращаемое значение: ошибка, если заказ не сохранен
 func (db *DB) insertOrder(ctx context.Context, tx pgx.Tx, order model.Order) error {
 	_, err := tx.Exec(ctx, `
-		INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
+		INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, status)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
 	`,
 
 		order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
-		order.CustomerID, order.DeliveryService, order.ShardKey, order.SmID, order.DateCreated, order.OofShard,
+		order.CustomerID, order.DeliveryService, order.ShardKey, order.SmID, order.DateCreated, order.OofShard, model.StatusCreated,
 	)
 	if err != nil {
 		// логгируем и возвращаем ошибку, если таковая есть
@@ -84,12 +191,12 @@ func (db *DB) insertOrder(ctx context.Context, tx pgx.Tx, order model.Order) err
 
 // функция для сохранения заказа в таблицу delivery
 // возвращаемое значение: ошибка, если заказ не сохранен
-func (db *DB) insertDelivery(ctx context.Context, tx pgx.Tx, orderUID string, delivery model.Delivery) error {
+func (db *DB) insertDelivery(ctx context.Context, tx pgx.Tx, orderUID string, dateCreated time.Time, delivery model.Delivery) error {
 	_, err := tx.Exec(ctx, `
-		INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+		INSERT INTO delivery (order_uid, date_created, name, phone, zip, city, address, region, email)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
 	`,
-		orderUID, delivery.Name, delivery.Phone, delivery.Zip, delivery.City, delivery.Address, delivery.Region, delivery.Email,
+		orderUID, dateCreated, delivery.Name, delivery.Phone, delivery.Zip, delivery.City, delivery.Address, delivery.Region, delivery.Email,
 	)
 
 	if err != nil {
@@ -105,12 +212,12 @@ func (db *DB) insertDelivery(ctx context.Context, tx pgx.Tx, orderUID string, de
 
 // функция для сохранения заказа в таблицу payment
 // возвращаемое значение: ошибка, если заказ не сохранен
-func (db *DB) insertPayment(ctx context.Context, tx pgx.Tx, orderUID string, payment model.Payment) error {
+func (db *DB) insertPayment(ctx context.Context, tx pgx.Tx, orderUID string, dateCreated time.Time, payment model.Payment) error {
 	_, err := tx.Exec(ctx, `
-		INSERT INTO payment (transaction, order_uid, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
+		INSERT INTO payment (transaction, order_uid, date_created, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
 	`,
-		payment.Transaction, orderUID, payment.RequestID, payment.Currency, payment.Provider, payment.Amount, payment.PaymentDT, payment.Bank, payment.DeliveryCost, payment.GoodsTotal, payment.CustomFee,
+		payment.Transaction, orderUID, dateCreated, payment.RequestID, payment.Currency, payment.Provider, payment.Amount, payment.PaymentDT, payment.Bank, payment.DeliveryCost, payment.GoodsTotal, payment.CustomFee,
 	)
 	if err != nil {
 		// логгируем и возвращаем ошибку, если таковая есть
@@ -126,23 +233,66 @@ func (db *DB) insertPayment(ctx context.Context, tx pgx.Tx, orderUID string, pay
 }
 
 // функция для сохранения заказа в таблицу items
+// для небольших заказов товары отправляются одним batch-запросом, для крупных - через COPY,
+// поэтому количество обращений к БД не зависит от количества товаров
 // возвращаемое значение: ошибка, если заказ не сохранен
-func (db *DB) insertItems(ctx context.Context, tx pgx.Tx, orderUID string, items []model.Item) error {
+func (db *DB) insertItems(ctx context.Context, tx pgx.Tx, orderUID string, dateCreated time.Time, items []model.Item) error {
+	var err error
+	if len(items) >= copyItemsThreshold {
+		err = db.copyItems(ctx, tx, orderUID, dateCreated, items)
+	} else {
+		err = db.batchItems(ctx, tx, orderUID, dateCreated, items)
+	}
+	if err != nil {
+		// логгируем и возвращаем ошибку, если таковая есть
+		log.Printf("[DB] Ошибка сохранения items для заказа %s в таблицу items: %v", orderUID, err)
+		return err
+	}
+
+	// при успешном сохранении items в таблице items, логгируем сообщение
+	log.Printf("[DB] Items для заказа %s успешно сохранены: %d шт.", orderUID, len(items))
+	return nil
+}
+
+// функция для сохранения items одним batch-запросом
+// возвращаемое значение: ошибка, если хотя бы один item не сохранен
+func (db *DB) batchItems(ctx context.Context, tx pgx.Tx, orderUID string, dateCreated time.Time, items []model.Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{} // собираем все вставки в один batch
 	for _, item := range items {
-		_, err := tx.Exec(ctx, `
-			INSERT INTO items (order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status)
-			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+		batch.Queue(`
+			INSERT INTO items (order_uid, date_created, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status)
+			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)
 		`,
-			orderUID, item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name, item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status,
+			orderUID, dateCreated, item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name, item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status,
 		)
-		if err != nil {
-			// логгируем и возвращаем ошибку, если таковая есть
-			log.Printf("[DB] Ошибка сохранения items для заказа %s в таблицу items: %v", orderUID, err)
+	}
+
+	results := tx.SendBatch(ctx, batch) // отправляем batch за одно обращение к БД
+	for range items {
+		if _, err := results.Exec(); err != nil {
+			results.Close()
 			return err
 		}
 	}
+	return results.Close()
+}
 
-	// при успешном сохранении items в таблице items, логгируем сообщение
-	log.Printf("[DB] Items для заказа %s успешно сохранены: %d шт.", orderUID, len(items))
-	return nil
+// функция для сохранения items через COPY
+// возвращаемое значение: ошибка, если items не сохранены
+func (db *DB) copyItems(ctx context.Context, tx pgx.Tx, orderUID string, dateCreated time.Time, items []model.Item) error {
+	_, err := tx.CopyFrom(ctx,
+		pgx.Identifier{"items"},
+		itemColumns,
+		pgx.CopyFromSlice(len(items), func(i int) ([]any, error) {
+			item := items[i]
+			return []any{
+				orderUID, dateCreated, item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name, item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status,
+			}, nil
+		}),
+	)
+	return err
 }
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"log"
+	"wb-tech-test/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// функция для полнотекстового поиска заказов по названиям и брендам товаров
+// заказы упорядочены по релевантности лучшего совпавшего товара (совпадение в названии весит больше, чем в бренде)
+// возвращаемое значение: слайс найденных заказов (не больше limit, начиная с offset) и ошибка, если поиск не выполнен
+func (db *DB) SearchOrders(ctx context.Context, query string, limit, offset int) ([]model.Order, error) {
+	var orders []model.Order
+	err := db.readSnapshot(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT i.order_uid, i.date_created
+			FROM items i, websearch_to_tsquery('simple', $1) q
+			WHERE i.search_vector @@ q
+			GROUP BY i.order_uid, i.date_created
+			ORDER BY MAX(ts_rank(i.search_vector, q)) DESC, i.order_uid
+			LIMIT $2 OFFSET $3
+		`, query, limit, offset)
+		if err != nil {
+			log.Printf("[DB] Ошибка поиска заказов по запросу %q: %v", query, err)
+			return err
+		}
+
+		keys, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (orderKey, error) {
+			var key orderKey
+			err := row.Scan(&key.OrderUID, &key.DateCreated)
+			return newOrderKey(key.OrderUID, key.DateCreated), err
+		})
+		if err != nil {
+			log.Printf("[DB] Ошибка сканирования order_uid: %v", err)
+			return err
+		}
+
+		orders, err = loadOrders(ctx, tx, keys) // товары, заказы и связанные данные читаются в одном снимке
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[DB] По запросу %q найдено заказов: %d", query, len(orders))
+	return orders, nil
+}
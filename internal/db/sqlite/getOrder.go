@@ -0,0 +1,100 @@
+package sqlite
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"wb-tech-test/internal/model"
+)
+
+// функция для получения заказа (а также связанные delivery, payment и items) по order_uid
+// возвращаемое значение: экземпляр структуры Order и ошибку (sql.ErrNoRows, если заказ не найден)
+func (s *DB) GetOrder(ctx context.Context, orderUID string) (model.Order, error) {
+	var order model.Order
+	var dateCreated string
+
+	// получаем заказ вместе с delivery и payment
+	err := s.Conn.QueryRowContext(ctx, `
+		SELECT o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature, o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard, o.status,
+		       d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
+		       p.transaction_id, p.request_id, p.currency, p.provider, p.amount, p.payment_dt, p.bank, p.delivery_cost, p.goods_total, p.custom_fee
+		FROM orders o
+		JOIN delivery d ON d.order_uid = o.order_uid
+		JOIN payment p ON p.order_uid = o.order_uid
+		WHERE o.order_uid = ?
+	`, orderUID).Scan(
+		&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale, &order.InternalSignature, &order.CustomerID,
+		&order.DeliveryService, &order.ShardKey, &order.SmID, &dateCreated, &order.OofShard, &order.Status,
+		&order.Delivery.Name, &order.Delivery.Phone, &order.Delivery.Zip, &order.Delivery.City,
+		&order.Delivery.Address, &order.Delivery.Region, &order.Delivery.Email,
+		&order.Payment.Transaction, &order.Payment.RequestID, &order.Payment.Currency, &order.Payment.Provider,
+		&order.Payment.Amount, &order.Payment.PaymentDT, &order.Payment.Bank, &order.Payment.DeliveryCost,
+		&order.Payment.GoodsTotal, &order.Payment.CustomFee,
+	)
+	if err != nil {
+		log.Printf("[SQLITE] Ошибка получения заказа %s: %v", orderUID, err)
+		return order, err
+	}
+
+	if order.DateCreated, err = time.Parse(timeLayout, dateCreated); err != nil {
+		return order, err
+	}
+
+	// получаем товары заказа
+	rows, err := s.Conn.QueryContext(ctx, `
+		SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
+		FROM items
+		WHERE order_uid = ?
+		ORDER BY id
+	`, orderUID)
+	if err != nil {
+		log.Printf("[SQLITE] Ошибка получения items для заказа %s: %v", orderUID, err)
+		return order, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item model.Item
+		err := rows.Scan(&item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid, &item.Name, &item.Sale,
+			&item.Size, &item.TotalPrice, &item.NmID, &item.Brand, &item.Status)
+		if err != nil {
+			log.Printf("[SQLITE] Ошибка сканирования item для заказа %s: %v", orderUID, err)
+			return order, err
+		}
+		order.Items = append(order.Items, item)
+	}
+	return order, rows.Err()
+}
+
+// функция для получения всех заказов
+// возвращаемое значение: слайс заказов и ошибка, если заказы не получены
+func (s *DB) GetAllOrders(ctx context.Context) ([]model.Order, error) {
+	rows, err := s.Conn.QueryContext(ctx, `SELECT order_uid FROM orders`)
+	if err != nil {
+		return nil, err
+	}
+
+	// сначала читаем все UID: соединение одно, и вложенные запросы не выполнятся, пока открыт rows
+	var uids []string
+	for rows.Next() {
+		var orderUID string
+		if err := rows.Scan(&orderUID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		uids = append(uids, orderUID)
+	}
+	rows.Close()
+
+	var orders []model.Order
+	for _, orderUID := range uids {
+		order, err := s.GetOrder(ctx, orderUID)
+		if err != nil {
+			log.Printf("[SQLITE] Ошибка получения заказа %s: %v", orderUID, err)
+			continue // пропускаем ошибочные заказы
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
@@ -0,0 +1,135 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// миграции схемы SQLite, повторяющие таблицы Postgres из каталога migration
+// файл N_name.sql переводит схему в версию N; текущая версия хранится в PRAGMA user_version
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// структура миграции схемы
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// функция для загрузки встроенных миграций
+// возвращаемое значение: миграции по возрастанию версии и ошибка, если имя файла некорректно
+func loadMigrations() ([]migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(entries))
+	for _, entry := range entries {
+		prefix, _, ok := strings.Cut(entry.Name(), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("некорректное имя файла миграции %s", entry.Name())
+		}
+		data, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: entry.Name(), sql: string(data)})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+// функция для применения миграций, которых еще нет в БД
+// каждая миграция выполняется в отдельной транзакции вместе с обновлением user_version
+// возвращаемое значение: ошибка, если схема не обновлена
+func migrate(ctx context.Context, conn *sql.DB) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	version, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		if err := applyMigration(ctx, conn, m); err != nil {
+			log.Printf("[SQLITE] Ошибка применения миграции %s: %v", m.name, err)
+			return fmt.Errorf("миграция %s: %w", m.name, err)
+		}
+		log.Printf("[SQLITE] Применена миграция %s", m.name)
+	}
+	return nil
+}
+
+// функция для выполнения одной миграции
+// возвращаемое значение: ошибка, если миграция не применена (в этом случае изменения откатываются)
+func applyMigration(ctx context.Context, conn *sql.DB, m migration) (err error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, m.sql); err != nil {
+		return err
+	}
+	// PRAGMA не поддерживает параметры, версия - число из имени файла
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", m.version)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// функция для получения версии схемы БД
+// БД, созданные до появления миграций, имеют user_version = 0, поэтому их версия определяется по существующим таблицам
+// возвращаемое значение: версия схемы (0 для новой БД) и ошибка, если версия не получена
+func schemaVersion(ctx context.Context, conn *sql.DB) (int, error) {
+	var version int
+	if err := conn.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	if version > 0 {
+		return version, nil
+	}
+
+	var tables int
+	if err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'orders'`).Scan(&tables); err != nil {
+		return 0, err
+	}
+	if tables == 0 {
+		return 0, nil // новая БД
+	}
+
+	// схема без версии: исходные таблицы (1) или уже с форматом исходного сообщения (2)
+	var columns int
+	err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_table_info('raw_messages') WHERE name = 'content_type'`).Scan(&columns)
+	if err != nil {
+		return 0, err
+	}
+	if columns > 0 {
+		return 2, nil
+	}
+	return 1, nil
+}
@@ -0,0 +1,2 @@
+ALTER TABLE raw_messages ADD COLUMN content_type TEXT NOT NULL DEFAULT 'application/json';
+ALTER TABLE raw_messages ADD COLUMN payload_binary BLOB;
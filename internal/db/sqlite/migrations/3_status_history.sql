@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS status_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_uid TEXT NOT NULL,
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    comment TEXT,
+    changed_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS status_history_order_uid_idx ON status_history (order_uid, id);
+
+INSERT INTO status_history (order_uid, from_status, to_status, changed_at)
+SELECT order_uid, NULL, status, strftime('%Y-%m-%dT%H:%M:%fZ', 'now') FROM orders;
@@ -0,0 +1,156 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"wb-tech-test/internal/db"
+	"wb-tech-test/internal/model"
+)
+
+// функция для сохранения заказа в БД
+// возвращаемое значение: ошибка, если заказ не сохранен
+func (s *DB) SaveOrder(ctx context.Context, order model.Order) error {
+	return s.saveOrder(ctx, order, nil)
+}
+
+// функция для сохранения заказа, полученного из Kafka, вместе с исходным сообщением и его смещением
+// возвращаемое значение: ошибка, если заказ не сохранен
+func (s *DB) SaveOrderFromMessage(ctx context.Context, order model.Order, source db.SourceMessage) error {
+	return s.saveOrder(ctx, order, &source)
+}
+
+// функция для сохранения заказа (delivery, payment и items) в одной транзакции
+// возвращаемое значение: ошибка (db.ErrOrderExists, если заказ или транзакция оплаты уже существуют)
+func (s *DB) saveOrder(ctx context.Context, order model.Order, source *db.SourceMessage) (err error) {
+	tx, err := s.Conn.BeginTx(ctx, nil) // создаем транзакцию
+	if err != nil {
+		log.Printf("[SQLITE] Ошибка при создании транзакции: %v", err)
+		return err
+	}
+	defer func() {
+		if err != nil {
+			log.Printf("[SQLITE] Откатываем транзакцию: %v", err)
+			tx.Rollback() // откатываем транзакцию, если возникла ошибка
+		}
+	}()
+
+	// проверяем, что заказа и транзакции оплаты еще нет
+	var exists bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM orders WHERE order_uid = ?) OR EXISTS(SELECT 1 FROM payment WHERE transaction_id = ?)
+	`, order.OrderUID, order.Payment.Transaction).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		err = fmt.Errorf("[SQLITE] Заказ %s или транзакция %s уже существует: %w", order.OrderUID, order.Payment.Transaction, db.ErrOrderExists)
+		return err
+	}
+
+	if err = insertOrder(ctx, tx, order); err != nil {
+		return err
+	}
+	if err = insertStatusChange(ctx, tx, &model.StatusChange{OrderUID: order.OrderUID, To: model.StatusCreated}); err != nil {
+		return err
+	}
+
+	// сохраняем исходное сообщение Kafka и его смещение
+	if source != nil {
+		if err = insertRawMessage(ctx, tx, order, *source); err != nil {
+			return err
+		}
+		if !source.DeferOffset {
+			if err = saveKafkaOffset(ctx, tx, *source); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("[SQLITE] Заказ %s успешно сохранён", order.OrderUID)
+	return nil
+}
+
+// функция для сохранения заказа в таблицы orders, delivery, payment и items
+// возвращаемое значение: ошибка, если заказ не сохранен
+func insertOrder(ctx context.Context, tx *sql.Tx, order model.Order) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, status)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?)
+	`,
+		order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
+		order.CustomerID, order.DeliveryService, order.ShardKey, order.SmID, formatTime(order.DateCreated), order.OofShard, model.StatusCreated,
+	)
+	if err != nil {
+		log.Printf("[SQLITE] Ошибка сохранения заказа %s в таблицу orders: %v", order.OrderUID, err)
+		return err
+	}
+
+	delivery := order.Delivery
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email)
+		VALUES (?,?,?,?,?,?,?,?)
+	`, order.OrderUID, delivery.Name, delivery.Phone, delivery.Zip, delivery.City, delivery.Address, delivery.Region, delivery.Email)
+	if err != nil {
+		log.Printf("[SQLITE] Ошибка сохранения delivery для заказа %s: %v", order.OrderUID, err)
+		return err
+	}
+
+	payment := order.Payment
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO payment (transaction_id, order_uid, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?)
+	`, payment.Transaction, order.OrderUID, payment.RequestID, payment.Currency, payment.Provider, payment.Amount, payment.PaymentDT, payment.Bank, payment.DeliveryCost, payment.GoodsTotal, payment.CustomFee)
+	if err != nil {
+		log.Printf("[SQLITE] Ошибка сохранения payment для заказа %s: %v", order.OrderUID, err)
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO items (order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, item := range order.Items {
+		_, err := stmt.ExecContext(ctx, order.OrderUID, item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name, item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status)
+		if err != nil {
+			log.Printf("[SQLITE] Ошибка сохранения items для заказа %s: %v", order.OrderUID, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// функция для сохранения исходного сообщения Kafka
+// возвращаемое значение: ошибка, если сообщение не сохранено
+func insertRawMessage(ctx context.Context, tx *sql.Tx, order model.Order, source db.SourceMessage) error {
+	orderUID := order.OrderUID
+	var messageTime any // у сообщения может не быть времени
+	if !source.Time.IsZero() {
+		messageTime = formatTime(source.Time)
+	}
+
+	contentType, payload, binary, err := source.Payloads(order)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO raw_messages (order_uid, topic, partition, "offset", key, payload, message_time, received_at, content_type, payload_binary)
+		VALUES (?,?,?,?,?,?,?,?,?,?)
+	`, orderUID, source.Topic, source.Partition, source.Offset, source.Key, string(payload), messageTime, formatTime(time.Now()), contentType, binary)
+	if err != nil {
+		log.Printf("[SQLITE] Ошибка сохранения исходного сообщения для заказа %s: %v", orderUID, err)
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"wb-tech-test/internal/db"
+
+	_ "modernc.org/sqlite" // драйвер SQLite без cgo
+)
+
+// формат хранения времени в SQLite (время хранится строкой в UTC)
+const timeLayout = time.RFC3339Nano
+
+// структура для хранилища заказов в SQLite
+// используется для локальной разработки без Postgres
+type DB struct {
+	Conn *sql.DB // соединение с файлом БД
+}
+
+// проверка на этапе компиляции, что DB реализует db.OrderStore
+var _ db.OrderStore = (*DB)(nil)
+
+// конструктор для открытия БД SQLite по пути к файлу (":memory:" - БД в памяти)
+// при открытии к БД применяются миграции схемы, которых в ней еще нет
+// возвращаемое значение: указатель на структуру DB и ошибка, если БД не открыта
+func NewDB(path string) (*DB, error) {
+	conn, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	conn.SetMaxOpenConns(1) // SQLite допускает одного писателя, поэтому используем одно соединение
+
+	if err := migrate(context.Background(), conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	log.Printf("[SQLITE] БД %s открыта", path)
+	return &DB{Conn: conn}, nil
+}
+
+// функция для закрытия соединения с БД
+func (s *DB) Close() {
+	s.Conn.Close()
+}
+
+// функция для проверки существования транзакции оплаты
+// возвращаемое значение: true, если транзакция существует, и ошибка, если проверка не выполнена
+func (s *DB) IsTransactionExists(ctx context.Context, transaction string) (bool, error) {
+	var exists bool
+	err := s.Conn.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM payment WHERE transaction_id = ?)
+	`, transaction).Scan(&exists)
+	return exists, err
+}
+
+// функция для проверки существования заказа с указанным order_uid
+// возвращаемое значение: true, если заказ существует, и ошибка, если проверка не выполнена
+func (s *DB) IsOrderExists(ctx context.Context, orderUID string) (bool, error) {
+	var exists bool
+	err := s.Conn.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM orders WHERE order_uid = ?)
+	`, orderUID).Scan(&exists)
+	return exists, err
+}
+
+// функция для получения сохраненных смещений по всем партициям топика
+// возвращаемое значение: мапа партиция -> следующее смещение для чтения и ошибка, если смещения не получены
+func (s *DB) GetKafkaOffsets(ctx context.Context, topic string) (map[int]int64, error) {
+	rows, err := s.Conn.QueryContext(ctx, `
+		SELECT partition, next_offset FROM kafka_offsets WHERE topic = ?
+	`, topic)
+	if err != nil {
+		log.Printf("[SQLITE] Ошибка получения смещений для топика %s: %v", topic, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	offsets := make(map[int]int64)
+	for rows.Next() {
+		var partition int
+		var offset int64
+		if err := rows.Scan(&partition, &offset); err != nil {
+			return nil, err
+		}
+		offsets[partition] = offset
+	}
+	return offsets, rows.Err()
+}
+
+// функция для сохранения смещения сообщения без сохранения заказа
+// возвращаемое значение: ошибка, если смещение не сохранено
+func (s *DB) SaveKafkaOffset(ctx context.Context, source db.SourceMessage) error {
+	return saveKafkaOffset(ctx, s.Conn, source)
+}
+
+// интерфейс для выполнения запросов как в транзакции, так и вне ее
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// функция для сохранения следующего смещения партиции
+// возвращаемое значение: ошибка, если смещение не сохранено
+func saveKafkaOffset(ctx context.Context, conn execer, source db.SourceMessage) error {
+	_, err := conn.ExecContext(ctx, `
+		INSERT INTO kafka_offsets (topic, partition, next_offset, updated_at)
+		VALUES (?,?,?,?)
+		ON CONFLICT (topic, partition) DO UPDATE
+		SET next_offset = excluded.next_offset, updated_at = excluded.updated_at
+	`, source.Topic, source.Partition, source.Offset+1, formatTime(time.Now()))
+	if err != nil {
+		log.Printf("[SQLITE] Ошибка сохранения смещения %d для %s/%d: %v", source.Offset, source.Topic, source.Partition, err)
+	}
+	return err
+}
+
+// функция для форматирования времени для хранения в SQLite
+// возвращаемое значение: время в UTC в формате RFC3339
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
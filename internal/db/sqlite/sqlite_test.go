@@ -0,0 +1,114 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"wb-tech-test/internal/db"
+	"wb-tech-test/internal/model"
+)
+
+// заказ для проверки хранилища
+func testOrder() model.Order {
+	return model.Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery:    model.Delivery{Name: "Test Testov", Phone: "+9720000000", City: "Kiryat Mozkin", Email: "test@gmail.com"},
+		Payment:     model.Payment{Transaction: "b563feb7b2b84b6test", Currency: "USD", Provider: "wbpay", Amount: 1817, GoodsTotal: 317},
+		Items:       []model.Item{{ChrtID: 9934930, Name: "Mascaras", Price: 453, TotalPrice: 317}},
+		Locale:      "en",
+		CustomerID:  "test",
+		DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+	}
+}
+
+func TestMigrateUpgradesUnversionedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.db")
+
+	// БД, созданная до появления миграций: исходная схема без user_version
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	conn, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	if _, err := conn.Exec(migrations[0].sql); err != nil {
+		t.Fatalf("исходная схема: %v", err)
+	}
+	conn.Close()
+
+	store, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	defer store.Close()
+
+	var version int
+	if err := store.Conn.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatalf("user_version: %v", err)
+	}
+	if want := migrations[len(migrations)-1].version; version != want {
+		t.Errorf("версия схемы %d, ожидается %d", version, want)
+	}
+
+	// сохранение исходного сообщения использует столбцы, добавленные миграцией
+	source := db.SourceMessage{Topic: "orders", Partition: 0, Offset: 7, Value: []byte(`{}`)}
+	if err := store.SaveOrderFromMessage(context.Background(), testOrder(), source); err != nil {
+		t.Fatalf("SaveOrderFromMessage: %v", err)
+	}
+
+	// повторное открытие не применяет миграции заново
+	reopened, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("повторное открытие: %v", err)
+	}
+	reopened.Close()
+}
+
+func TestStatusHistory(t *testing.T) {
+	store, err := NewDB(filepath.Join(t.TempDir(), "orders.db"))
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	order := testOrder()
+	if err := store.SaveOrder(ctx, order); err != nil {
+		t.Fatalf("SaveOrder: %v", err)
+	}
+	if _, err := store.TransitionOrderStatus(ctx, order.OrderUID, model.StatusPaid, "оплачено"); err != nil {
+		t.Fatalf("created -> paid: %v", err)
+	}
+	if _, err := store.TransitionOrderStatus(ctx, order.OrderUID, model.StatusCreated, ""); !errors.Is(err, model.ErrInvalidStatusTransition) {
+		t.Errorf("paid -> created: ошибка %v, ожидается ErrInvalidStatusTransition", err)
+	}
+	if _, err := store.TransitionOrderStatus(ctx, "unknown", model.StatusPaid, ""); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("неизвестный заказ: ошибка %v, ожидается sql.ErrNoRows", err)
+	}
+
+	history, err := store.GetStatusHistory(ctx, order.OrderUID)
+	if err != nil {
+		t.Fatalf("GetStatusHistory: %v", err)
+	}
+	if len(history) != 2 ||
+		history[0].From != "" || history[0].To != model.StatusCreated ||
+		history[1].From != model.StatusCreated || history[1].To != model.StatusPaid || history[1].Comment != "оплачено" {
+		t.Errorf("история статусов %+v, ожидается created, затем created -> paid", history)
+	}
+
+	saved, err := store.GetOrder(ctx, order.OrderUID)
+	if err != nil {
+		t.Fatalf("GetOrder: %v", err)
+	}
+	if saved.Status != model.StatusPaid {
+		t.Errorf("статус заказа %q, ожидается %q", saved.Status, model.StatusPaid)
+	}
+}
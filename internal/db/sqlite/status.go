@@ -0,0 +1,112 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"wb-tech-test/internal/model"
+)
+
+// функция для смены статуса заказа
+// переход проверяется по жизненному циклу заказа, смена статуса и запись в истории сохраняются в одной транзакции
+// (соединение с БД одно, поэтому смены статуса выполняются по очереди)
+// возвращаемое значение: запись о смене статуса и ошибка (sql.ErrNoRows, если заказ не найден,
+// model.ErrInvalidStatusTransition, если переход недопустим)
+func (s *DB) TransitionOrderStatus(ctx context.Context, orderUID string, to model.OrderStatus, comment string) (change model.StatusChange, err error) {
+	tx, err := s.Conn.BeginTx(ctx, nil) // создаем транзакцию
+	if err != nil {
+		log.Printf("[SQLITE] Ошибка при создании транзакции: %v", err)
+		return change, err
+	}
+	defer func() {
+		if err != nil {
+			log.Printf("[SQLITE] Откатываем транзакцию: %v", err)
+			tx.Rollback() // откатываем транзакцию, если возникла ошибка
+		}
+	}()
+
+	var from model.OrderStatus
+	err = tx.QueryRowContext(ctx, `SELECT status FROM orders WHERE order_uid = ?`, orderUID).Scan(&from)
+	if err != nil {
+		log.Printf("[SQLITE] Ошибка получения статуса заказа %s: %v", orderUID, err)
+		return change, err
+	}
+
+	if !from.CanTransitionTo(to) {
+		err = fmt.Errorf("%w: %s -> %s", model.ErrInvalidStatusTransition, from, to)
+		return change, err
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE orders SET status = ? WHERE order_uid = ?`, to, orderUID); err != nil {
+		log.Printf("[SQLITE] Ошибка обновления статуса заказа %s: %v", orderUID, err)
+		return change, err
+	}
+
+	change = model.StatusChange{OrderUID: orderUID, From: from, To: to, Comment: comment}
+	if err = insertStatusChange(ctx, tx, &change); err != nil {
+		return change, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return change, err
+	}
+	log.Printf("[SQLITE] Статус заказа %s изменен: %s -> %s", orderUID, from, to)
+	return change, nil
+}
+
+// функция для получения истории статусов заказа
+// возвращаемое значение: слайс записей о смене статуса в хронологическом порядке и ошибка, если история не получена
+func (s *DB) GetStatusHistory(ctx context.Context, orderUID string) ([]model.StatusChange, error) {
+	rows, err := s.Conn.QueryContext(ctx, `
+		SELECT order_uid, COALESCE(from_status, ''), to_status, COALESCE(comment, ''), changed_at
+		FROM status_history
+		WHERE order_uid = ?
+		ORDER BY id
+	`, orderUID)
+	if err != nil {
+		log.Printf("[SQLITE] Ошибка получения истории статусов заказа %s: %v", orderUID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []model.StatusChange
+	for rows.Next() {
+		var change model.StatusChange
+		var changedAt string
+		if err := rows.Scan(&change.OrderUID, &change.From, &change.To, &change.Comment, &changedAt); err != nil {
+			log.Printf("[SQLITE] Ошибка сканирования истории статусов заказа %s: %v", orderUID, err)
+			return nil, err
+		}
+		if change.ChangedAt, err = time.Parse(timeLayout, changedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
+// функция для сохранения записи о смене статуса в таблицу status_history
+// возвращаемое значение: ошибка, если запись не сохранена
+func insertStatusChange(ctx context.Context, tx *sql.Tx, change *model.StatusChange) error {
+	var from any // у первой записи предыдущего статуса нет
+	if change.From != "" {
+		from = change.From
+	}
+	var comment any
+	if change.Comment != "" {
+		comment = change.Comment
+	}
+
+	change.ChangedAt = time.Now().UTC()
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO status_history (order_uid, from_status, to_status, comment, changed_at)
+		VALUES (?,?,?,?,?)
+	`, change.OrderUID, from, change.To, comment, formatTime(change.ChangedAt))
+	if err != nil {
+		log.Printf("[SQLITE] Ошибка сохранения истории статусов для заказа %s: %v", change.OrderUID, err)
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"wb-tech-test/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// функция для смены статуса заказа
+// переход проверяется по жизненному циклу заказа, смена статуса и запись в истории сохраняются в одной транзакции
+// возвращаемое значение: запись о смене статуса и ошибка (pgx.ErrNoRows, если заказ не найден,
+// model.ErrInvalidStatusTransition, если переход недопустим)
+func (db *DB) TransitionOrderStatus(ctx context.Context, orderUID string, to model.OrderStatus, comment string) (change model.StatusChange, err error) {
+	tx, err := db.Pool.Begin(ctx) // создаем транзакцию
+	if err != nil {
+		log.Printf("[DB] Ошибка при создании транзакции: %v", err)
+		return change, err
+	}
+	defer func() {
+		if err != nil {
+			log.Printf("[DB] Откатываем транзакцию: %v", err)
+			tx.Rollback(ctx) // откатываем транзакцию, если возникла ошибка
+		}
+	}()
+
+	// блокируем заказ, чтобы параллельные смены статуса выполнялись по очереди
+	var from model.OrderStatus
+	err = tx.QueryRow(ctx, `
+		SELECT status FROM orders WHERE order_uid = $1 FOR UPDATE
+	`, orderUID).Scan(&from)
+	if err != nil {
+		log.Printf("[DB] Ошибка получения статуса заказа %s: %v", orderUID, err)
+		return change, err
+	}
+
+	if !from.CanTransitionTo(to) {
+		err = fmt.Errorf("%w: %s -> %s", model.ErrInvalidStatusTransition, from, to)
+		return change, err
+	}
+
+	if _, err = tx.Exec(ctx, `
+		UPDATE orders SET status = $2 WHERE order_uid = $1
+	`, orderUID, to); err != nil {
+		log.Printf("[DB] Ошибка обновления статуса заказа %s: %v", orderUID, err)
+		return change, err
+	}
+
+	change = model.StatusChange{OrderUID: orderUID, From: from, To: to, Comment: comment}
+	if err = db.insertStatusChange(ctx, tx, &change); err != nil {
+		return change, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return change, err
+	}
+	db.markRecent(orderUID) // сразу после смены статуса читаем заказ с primary
+
+	log.Printf("[DB] Статус заказа %s изменен: %s -> %s", orderUID, from, to)
+	return change, nil
+}
+
+// функция для получения истории статусов заказа
+// возвращаемое значение: слайс записей о смене статуса в хронологическом порядке и ошибка, если история не получена
+func (db *DB) GetStatusHistory(ctx context.Context, orderUID string) ([]model.StatusChange, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT order_uid, COALESCE(from_status, ''), to_status, COALESCE(comment, ''), changed_at
+		FROM status_history
+		WHERE order_uid = $1
+		ORDER BY id
+	`, orderUID)
+	if err != nil {
+		log.Printf("[DB] Ошибка получения истории статусов заказа %s: %v", orderUID, err)
+		return nil, err
+	}
+
+	history, err := pgx.CollectRows(rows, scanStatusChange)
+	if err != nil {
+		log.Printf("[DB] Ошибка сканирования истории статусов заказа %s: %v", orderUID, err)
+		return nil, err
+	}
+	return history, nil
+}
+
+// функция для сохранения записи о смене статуса в таблицу status_history
+// время смены статуса заполняется из БД
+// возвращаемое значение: ошибка, если запись не сохранена
+func (db *DB) insertStatusChange(ctx context.Context, tx pgx.Tx, change *model.StatusChange) error {
+	var from *model.OrderStatus // у первой записи предыдущего статуса нет
+	if change.From != "" {
+		from = &change.From
+	}
+
+	err := tx.QueryRow(ctx, `
+		INSERT INTO status_history (order_uid, from_status, to_status, comment)
+		VALUES ($1,$2,$3,NULLIF($4, ''))
+		RETURNING changed_at
+	`, change.OrderUID, from, change.To, change.Comment).Scan(&change.ChangedAt)
+	if err != nil {
+		log.Printf("[DB] Ошибка сохранения истории статусов для заказа %s: %v", change.OrderUID, err)
+		return err
+	}
+	return nil
+}
+
+// функция для сканирования строки таблицы status_history
+// возвращаемое значение: запись о смене статуса и ошибка сканирования
+func scanStatusChange(row pgx.CollectableRow) (model.StatusChange, error) {
+	var change model.StatusChange
+	err := row.Scan(&change.OrderUID, &change.From, &change.To, &change.Comment, &change.ChangedAt)
+	return change, err
+}
@@ -0,0 +1,25 @@
+package db
+
+import (
+	"context"
+	"wb-tech-test/internal/model"
+)
+
+// интерфейс хранилища заказов
+// реализуется Postgres (DB) и SQLite (пакет db/sqlite) для локальной разработки без внешних сервисов
+type OrderStore interface {
+	SaveOrder(ctx context.Context, order model.Order) error
+	SaveOrderFromMessage(ctx context.Context, order model.Order, source SourceMessage) error
+	SaveKafkaOffset(ctx context.Context, source SourceMessage) error
+	GetKafkaOffsets(ctx context.Context, topic string) (map[int]int64, error)
+	GetOrder(ctx context.Context, orderUID string) (model.Order, error)
+	GetAllOrders(ctx context.Context) ([]model.Order, error)
+	IsTransactionExists(ctx context.Context, transaction string) (bool, error)
+	IsOrderExists(ctx context.Context, orderUID string) (bool, error)
+	TransitionOrderStatus(ctx context.Context, orderUID string, to model.OrderStatus, comment string) (model.StatusChange, error)
+	GetStatusHistory(ctx context.Context, orderUID string) ([]model.StatusChange, error)
+	Close()
+}
+
+// проверка на этапе компиляции, что DB реализует OrderStore
+var _ OrderStore = (*DB)(nil)
@@ -0,0 +1,151 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"wb-tech-test/internal/model"
+
+	"github.com/hamba/avro/v2"
+)
+
+// первый байт сообщения в формате Schema Registry
+const avroMagicByte = 0
+
+// ошибка, возвращаемая для сообщения не в формате Schema Registry
+var ErrInvalidAvroFrame = errors.New("сообщение не в формате Schema Registry")
+
+// декодер заказов в формате Avro
+// тело сообщения: магический байт 0, идентификатор схемы (4 байта, big-endian) и данные, записанные по этой схеме
+type AvroDecoder struct {
+	Registry *SchemaRegistry // реестр схем, по которым записаны сообщения
+}
+
+// структуры заказа для декодирования Avro (имена полей совпадают со схемой schemas/order.avsc)
+type avroOrder struct {
+	OrderUID          string       `avro:"order_uid"`
+	TrackNumber       string       `avro:"track_number"`
+	Entry             string       `avro:"entry"`
+	Delivery          avroDelivery `avro:"delivery"`
+	Payment           avroPayment  `avro:"payment"`
+	Items             []avroItem   `avro:"items"`
+	Locale            string       `avro:"locale"`
+	InternalSignature string       `avro:"internal_signature"`
+	CustomerID        string       `avro:"customer_id"`
+	DeliveryService   string       `avro:"delivery_service"`
+	ShardKey          string       `avro:"shardkey"`
+	SmID              int64        `avro:"sm_id"`
+	DateCreated       time.Time    `avro:"date_created"`
+	OofShard          string       `avro:"oof_shard"`
+}
+
+type avroDelivery struct {
+	Name    string `avro:"name"`
+	Phone   string `avro:"phone"`
+	Zip     string `avro:"zip"`
+	City    string `avro:"city"`
+	Address string `avro:"address"`
+	Region  string `avro:"region"`
+	Email   string `avro:"email"`
+}
+
+type avroPayment struct {
+	Transaction  string `avro:"transaction"`
+	RequestID    string `avro:"request_id"`
+	Currency     string `avro:"currency"`
+	Provider     string `avro:"provider"`
+	Amount       int64  `avro:"amount"`
+	PaymentDT    int64  `avro:"payment_dt"`
+	Bank         string `avro:"bank"`
+	DeliveryCost int64  `avro:"delivery_cost"`
+	GoodsTotal   int64  `avro:"goods_total"`
+	CustomFee    int64  `avro:"custom_fee"`
+}
+
+type avroItem struct {
+	ChrtID      int64  `avro:"chrt_id"`
+	TrackNumber string `avro:"track_number"`
+	Price       int64  `avro:"price"`
+	Rid         string `avro:"rid"`
+	Name        string `avro:"name"`
+	Sale        int64  `avro:"sale"`
+	Size        string `avro:"size"`
+	TotalPrice  int64  `avro:"total_price"`
+	NmID        int64  `avro:"nm_id"`
+	Brand       string `avro:"brand"`
+	Status      int64  `avro:"status"`
+}
+
+// функция для декодирования заказа из Avro по схеме, указанной в сообщении
+// возвращаемое значение: заказ и ошибка, если схема не найдена или данные некорректны
+func (d *AvroDecoder) Decode(value []byte) (model.Order, error) {
+	if len(value) < 5 || value[0] != avroMagicByte {
+		return model.Order{}, ErrInvalidAvroFrame
+	}
+	schema, err := d.Registry.Schema(int(binary.BigEndian.Uint32(value[1:5])))
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	var decoded avroOrder
+	if err := avro.Unmarshal(schema, value[5:], &decoded); err != nil {
+		return model.Order{}, err
+	}
+	return decoded.toModel(), nil
+}
+
+// функция для преобразования декодированного Avro-заказа в модель
+// возвращаемое значение: заказ
+func (o avroOrder) toModel() model.Order {
+	order := model.Order{
+		OrderUID:    o.OrderUID,
+		TrackNumber: o.TrackNumber,
+		Entry:       o.Entry,
+		Delivery: model.Delivery{
+			Name:    o.Delivery.Name,
+			Phone:   o.Delivery.Phone,
+			Zip:     o.Delivery.Zip,
+			City:    o.Delivery.City,
+			Address: o.Delivery.Address,
+			Region:  o.Delivery.Region,
+			Email:   o.Delivery.Email,
+		},
+		Payment: model.Payment{
+			Transaction:  o.Payment.Transaction,
+			RequestID:    o.Payment.RequestID,
+			Currency:     o.Payment.Currency,
+			Provider:     o.Payment.Provider,
+			Amount:       int(o.Payment.Amount),
+			PaymentDT:    int(o.Payment.PaymentDT),
+			Bank:         o.Payment.Bank,
+			DeliveryCost: int(o.Payment.DeliveryCost),
+			GoodsTotal:   int(o.Payment.GoodsTotal),
+			CustomFee:    int(o.Payment.CustomFee),
+		},
+		Locale:            o.Locale,
+		InternalSignature: o.InternalSignature,
+		CustomerID:        o.CustomerID,
+		DeliveryService:   o.DeliveryService,
+		ShardKey:          o.ShardKey,
+		SmID:              int(o.SmID),
+		DateCreated:       o.DateCreated.UTC(),
+		OofShard:          o.OofShard,
+	}
+	for _, item := range o.Items {
+		order.Items = append(order.Items, model.Item{
+			ChrtID:      int(item.ChrtID),
+			TrackNumber: item.TrackNumber,
+			Price:       int(item.Price),
+			Rid:         item.Rid,
+			Name:        item.Name,
+			Sale:        int(item.Sale),
+			Size:        item.Size,
+			TotalPrice:  int(item.TotalPrice),
+			NmID:        int(item.NmID),
+			Brand:       item.Brand,
+			Status:      int(item.Status),
+		})
+	}
+	return order
+}
@@ -0,0 +1,161 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"wb-tech-test/internal/db"
+	"wb-tech-test/internal/model"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// функция для пакетного чтения сообщений из одной партиции
+// сообщения собираются в пакет до BatchSize штук или до истечения BatchTimeout и сохраняются в одной транзакции
+// вместе со смещением последнего сообщения пакета; отклоненные сообщения публикуются в dead-letter топик
+// до фиксации смещения, как и при обработке по одному, поэтому сбой после публикации приводит к повторной публикации,
+// а не к потере сообщения
+func (c *Consumer) consumePartitionBatches(ctx context.Context, reader *kafka.Reader, store db.BatchOrderStore) {
+	for {
+		messages := c.fetchBatch(ctx, reader)
+		if ctx.Err() != nil && len(messages) == 0 {
+			return // консьюмер остановлен
+		}
+		if len(messages) == 0 {
+			continue
+		}
+
+		// прочитанный пакет дообрабатывается даже после отмены контекста
+		processCtx := context.WithoutCancel(ctx)
+		start := time.Now()
+
+		// валидация и десериализация не зависят от попытки, поэтому выполняются, а их ошибки публикуются один раз
+		batch, rejected := c.decodeBatch(messages)
+		published := 0
+		if !c.retryBatch(ctx, messages, func(int) error {
+			for ; published < len(rejected); published++ {
+				if err := c.rejectMessage(processCtx, rejected[published], 1); err != nil {
+					return err
+				}
+			}
+			return nil
+		}) {
+			return // консьюмер остановлен, смещение не сохранено - пакет будет прочитан повторно
+		}
+
+		// заказ, отклоненный при сохранении, публикуется внутри транзакции пакета:
+		// если публикация не удалась, транзакция откатывается и пакет сохраняется повторно
+		var saved []model.Order
+		if !c.retryBatch(ctx, messages, func(attempt int) (err error) {
+			saved, err = store.SaveOrderBatch(processCtx, batch, sourceMessage(messages[len(messages)-1]), func(item db.BatchOrder, reason error) error {
+				if errors.Is(reason, db.ErrOrderExists) {
+					return nil // повторно доставленный заказ пропускается без публикации в dead-letter топик
+				}
+				return c.rejectMessage(processCtx, rejection{msg: messageAt(messages, item.Source.Offset), stage: StageSave, reason: reason}, attempt)
+			})
+			return err
+		}) {
+			return
+		}
+
+		for _, order := range saved {
+			c.Cache.Set(order)
+		}
+		first := messages[0]
+		c.Metrics.observeLatency(first.Topic, first.Partition, start)
+		c.Metrics.addProcessed(first.Topic, first.Partition, resultSaved, len(saved))
+		c.Metrics.addProcessed(first.Topic, first.Partition, resultSkipped, len(messages)-len(saved))
+	}
+}
+
+// структура для сообщения пакета, исключенного из обработки
+type rejection struct {
+	msg    kafka.Message // исходное сообщение
+	stage  string        // этап, на котором сообщение отклонено
+	reason error         // причина
+}
+
+// функция для чтения пакета сообщений
+// первое сообщение ожидается без ограничения по времени (ошибки чтения повторяются с задержкой), остальные - не дольше BatchTimeout
+// возвращаемое значение: прочитанные сообщения (пустой слайс при остановке консьюмера)
+func (c *Consumer) fetchBatch(ctx context.Context, reader *kafka.Reader) []kafka.Message {
+	msg, ok := fetchMessage(ctx, reader)
+	if !ok {
+		return nil // консьюмер остановлен
+	}
+	messages := []kafka.Message{msg}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, c.BatchTimeout)
+	defer cancel()
+	for len(messages) < c.BatchSize {
+		msg, err := reader.FetchMessage(fetchCtx)
+		if err != nil {
+			break // пакет не заполнился за BatchTimeout - сохраняем то, что есть
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// функция для проверки и десериализации сообщений пакета
+// сообщения, которые не проходят валидацию или не десериализуются, в пакет не попадают
+// возвращаемое значение: заказы пакета и отклоненные сообщения
+func (c *Consumer) decodeBatch(messages []kafka.Message) ([]db.BatchOrder, []rejection) {
+	batch := make([]db.BatchOrder, 0, len(messages))
+	var rejected []rejection
+	for _, msg := range messages {
+		order, stage, err := c.decodeMessage(msg)
+		if err != nil {
+			log.Printf("[KAFKA] Сообщение %d из партиции %d не обработано (%s): %v", msg.Offset, msg.Partition, stage, err)
+			rejected = append(rejected, rejection{msg: msg, stage: stage, reason: err})
+			continue
+		}
+		order.Status = model.StatusCreated // новый заказ всегда начинает жизненный цикл со статуса created
+		batch = append(batch, db.BatchOrder{Order: order, Source: sourceMessage(msg)})
+	}
+	return batch, rejected
+}
+
+// функция для отправки отклоненного сообщения пакета в dead-letter топик
+// без dead-letter топика сообщение только логируется и пропускается вместе с пакетом
+// возвращаемое значение: ошибка, если сообщение не опубликовано
+func (c *Consumer) rejectMessage(ctx context.Context, r rejection, attempts int) error {
+	if c.DeadLetter == nil {
+		log.Printf("[KAFKA] Сообщение %d из партиции %d пропущено (%s): %v", r.msg.Offset, r.msg.Partition, r.stage, r.reason)
+	} else if err := c.DeadLetter.Publish(ctx, r.msg, r.stage, r.reason, attempts); err != nil {
+		return err
+	}
+	c.Metrics.addError(r.msg.Topic, r.msg.Partition, r.stage)
+	return nil
+}
+
+// функция для поиска сообщения пакета по смещению
+// возвращаемое значение: сообщение с указанным смещением
+func messageAt(messages []kafka.Message, offset int64) kafka.Message {
+	for _, msg := range messages {
+		if msg.Offset == offset {
+			return msg
+		}
+	}
+	return kafka.Message{Offset: offset}
+}
+
+// функция для повторного выполнения шага обработки пакета с экспоненциальной задержкой
+// возвращаемое значение: false, если консьюмер остановлен до успешного выполнения
+func (c *Consumer) retryBatch(ctx context.Context, messages []kafka.Message, step func(attempt int) error) bool {
+	first, last := messages[0], messages[len(messages)-1]
+	for attempt := 1; ; attempt++ {
+		err := step(attempt)
+		if err == nil {
+			return true
+		}
+		c.Metrics.addError(first.Topic, first.Partition, stageRetry)
+		delay := retryBackoff(attempt)
+		log.Printf("[KAFKA] Повторная обработка пакета %d-%d из партиции %d через %s (попытка %d): %v", first.Offset, last.Offset, first.Partition, delay, attempt+1, err)
+		if !sleepContext(ctx, delay) {
+			return false
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"wb-tech-test/internal/model"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// заголовок сообщения с форматом тела (если не задан, тело считается JSON)
+const HeaderContentType = "content-type"
+
+// форматы тела сообщения с заказом
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeAvro     = "application/vnd.kafka.avro.v2+binary" // Avro в формате Schema Registry: 0x00, id схемы, данные
+)
+
+// ошибка, возвращаемая для сообщения с неизвестным форматом тела
+var ErrUnsupportedContentType = errors.New("неподдерживаемый формат сообщения")
+
+// интерфейс декодера тела сообщения в заказ
+type OrderDecoder interface {
+	Decode(value []byte) (model.Order, error)
+}
+
+// функция для создания декодеров всех поддерживаемых форматов
+// Avro-сообщения декодируются по схемам из переданного реестра
+// возвращаемое значение: мапа формат -> декодер
+func NewOrderDecoders(registry *SchemaRegistry) map[string]OrderDecoder {
+	return map[string]OrderDecoder{
+		ContentTypeJSON:     JSONDecoder{},
+		ContentTypeProtobuf: ProtobufDecoder{},
+		ContentTypeAvro:     &AvroDecoder{Registry: registry},
+	}
+}
+
+// декодер заказов в формате JSON
+type JSONDecoder struct{}
+
+// функция для декодирования заказа из JSON
+// возвращаемое значение: заказ и ошибка, если JSON некорректен
+func (JSONDecoder) Decode(value []byte) (model.Order, error) {
+	var order model.Order
+	err := json.Unmarshal(value, &order)
+	return order, err
+}
+
+// функция для получения формата тела сообщения из заголовка content-type
+// параметры формата (например, charset) отбрасываются
+// возвращаемое значение: формат тела сообщения (JSON, если заголовок не задан)
+func contentType(msg kafka.Message) string {
+	for _, header := range msg.Headers {
+		if strings.EqualFold(header.Key, HeaderContentType) {
+			value, _, _ := strings.Cut(string(header.Value), ";")
+			return strings.ToLower(strings.TrimSpace(value))
+		}
+	}
+	return ContentTypeJSON
+}
+
+// функция для декодирования заказа из сообщения декодером, выбранным по заголовку content-type
+// без заданных декодеров поддерживается только JSON
+// возвращаемое значение: заказ и ошибка, если формат не поддерживается или тело некорректно
+func (c *Consumer) decode(msg kafka.Message) (model.Order, error) {
+	format := contentType(msg)
+	decoder, ok := c.Decoders[format]
+	if !ok && c.Decoders == nil && format == ContentTypeJSON {
+		decoder, ok = JSONDecoder{}, true
+	}
+	if !ok {
+		return model.Order{}, fmt.Errorf("%w: %s", ErrUnsupportedContentType, format)
+	}
+	return decoder.Decode(msg.Value)
+}
+
+// функция для проверки и декодирования сообщения
+// JSON проверяется по схеме заказа до декодирования, чтобы лишние и пропущенные поля не терялись при разборе;
+// двоичные форматы проверяются после декодирования: заказ сериализуется в JSON и проверяется той же схемой,
+// но так проверяются только значения полей (диапазоны, форматы, шаблоны, непустые строки и списки), а не их наличие:
+// сериализованный заказ всегда содержит все поля, поэтому required и additionalProperties для него не срабатывают.
+// В proto3 нулевые значения не передаются, поэтому пропущенное поле Protobuf неотличимо от нулевого значения
+// и отклоняется, только если нулевое значение недопустимо по схеме (например, пустой order_uid или валюта);
+// в Avro наличие полей без значения по умолчанию гарантирует схема записи. Неизвестные поля Protobuf отбрасываются
+// некорректный JSON отклоняется на этапе StageDecode, как и неразобранное тело двоичного формата
+// возвращаемое значение: заказ, этап, на котором сообщение отклонено (StageValidate или StageDecode), и ошибка
+func (c *Consumer) decodeMessage(msg kafka.Message) (model.Order, string, error) {
+	binary := contentType(msg) != ContentTypeJSON
+	if !binary {
+		if err := c.validate(msg, msg.Value); err != nil {
+			return model.Order{}, validationStage(err), err
+		}
+	}
+
+	order, err := c.decode(msg)
+	if err != nil {
+		return order, StageDecode, err
+	}
+
+	if binary && c.Validator != nil {
+		data, err := json.Marshal(order)
+		if err != nil {
+			return order, StageDecode, err
+		}
+		if err := c.validate(msg, data); err != nil {
+			return order, StageValidate, err
+		}
+	}
+	return order, "", nil
+}
@@ -0,0 +1,272 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"wb-tech-test/internal/model"
+	"wb-tech-test/internal/validation"
+
+	"github.com/hamba/avro/v2"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// заказ для проверки декодеров (время с точностью до миллисекунд, как в Avro timestamp-millis)
+func testOrder() model.Order {
+	return model.Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: model.Delivery{
+			Name:    "Test Testov",
+			Phone:   "+9720000000",
+			Zip:     "2639809",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Region:  "Kraiot",
+			Email:   "test@gmail.com",
+		},
+		Payment: model.Payment{
+			Transaction:  "b563feb7b2b84b6test",
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       1817,
+			PaymentDT:    1637907727,
+			Bank:         "alpha",
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+			CustomFee:    0,
+		},
+		Items: []model.Item{
+			{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453, Rid: "ab4219087a764ae0btest", Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: 317, NmID: 2389212, Brand: "Vivienne Sabo", Status: 202},
+			{ChrtID: 9934931, TrackNumber: "WBILMTESTTRACK", Price: 100, Rid: "ab4219087a764ae0btes2", Name: "Brush", Sale: 0, Size: "S", TotalPrice: 100, NmID: 2389213, Brand: "Vivienne Sabo", Status: 202},
+		},
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		ShardKey:        "9",
+		SmID:            99,
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 123_000_000, time.UTC),
+		OofShard:        "1",
+	}
+}
+
+// функция для кодирования заказа в Protobuf по номерам полей из schemas/order.proto
+func encodeProtoOrder(o model.Order) []byte {
+	var b []byte
+	// как и сгенерированный код proto3, поля с нулевыми значениями не записываются
+	str := func(b []byte, num protowire.Number, v string) []byte {
+		if v == "" {
+			return b
+		}
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendString(b, v)
+	}
+	num := func(b []byte, n protowire.Number, v int) []byte {
+		if v == 0 {
+			return b
+		}
+		b = protowire.AppendTag(b, n, protowire.VarintType)
+		return protowire.AppendVarint(b, uint64(int64(v)))
+	}
+	msg := func(b []byte, n protowire.Number, v []byte) []byte {
+		b = protowire.AppendTag(b, n, protowire.BytesType)
+		return protowire.AppendBytes(b, v)
+	}
+
+	var delivery []byte
+	delivery = str(delivery, 1, o.Delivery.Name)
+	delivery = str(delivery, 2, o.Delivery.Phone)
+	delivery = str(delivery, 3, o.Delivery.Zip)
+	delivery = str(delivery, 4, o.Delivery.City)
+	delivery = str(delivery, 5, o.Delivery.Address)
+	delivery = str(delivery, 6, o.Delivery.Region)
+	delivery = str(delivery, 7, o.Delivery.Email)
+
+	var payment []byte
+	payment = str(payment, 1, o.Payment.Transaction)
+	payment = str(payment, 2, o.Payment.RequestID)
+	payment = str(payment, 3, o.Payment.Currency)
+	payment = str(payment, 4, o.Payment.Provider)
+	payment = num(payment, 5, o.Payment.Amount)
+	payment = num(payment, 6, o.Payment.PaymentDT)
+	payment = str(payment, 7, o.Payment.Bank)
+	payment = num(payment, 8, o.Payment.DeliveryCost)
+	payment = num(payment, 9, o.Payment.GoodsTotal)
+	payment = num(payment, 10, o.Payment.CustomFee)
+
+	var timestamp []byte
+	timestamp = num(timestamp, 1, int(o.DateCreated.Unix()))
+	timestamp = num(timestamp, 2, o.DateCreated.Nanosecond())
+
+	b = str(b, 1, o.OrderUID)
+	b = str(b, 2, o.TrackNumber)
+	b = str(b, 3, o.Entry)
+	b = msg(b, 4, delivery)
+	b = msg(b, 5, payment)
+	for _, it := range o.Items {
+		var item []byte
+		item = num(item, 1, it.ChrtID)
+		item = str(item, 2, it.TrackNumber)
+		item = num(item, 3, it.Price)
+		item = str(item, 4, it.Rid)
+		item = str(item, 5, it.Name)
+		item = num(item, 6, it.Sale)
+		item = str(item, 7, it.Size)
+		item = num(item, 8, it.TotalPrice)
+		item = num(item, 9, it.NmID)
+		item = str(item, 10, it.Brand)
+		item = num(item, 11, it.Status)
+		b = msg(b, 6, item)
+	}
+	b = str(b, 7, o.Locale)
+	b = str(b, 8, o.InternalSignature)
+	b = str(b, 9, o.CustomerID)
+	b = str(b, 10, o.DeliveryService)
+	b = str(b, 11, o.ShardKey)
+	b = num(b, 12, o.SmID)
+	b = msg(b, 13, timestamp)
+	b = str(b, 14, o.OofShard)
+	b = str(b, 99, "неизвестное поле пропускается")
+	return b
+}
+
+// функция для кодирования заказа в Avro по схеме schemas/order.avsc в формате Schema Registry
+func encodeAvroOrder(t *testing.T, schemaID int, o model.Order) []byte {
+	t.Helper()
+	items := make([]map[string]any, 0, len(o.Items))
+	for _, it := range o.Items {
+		items = append(items, map[string]any{
+			"chrt_id": int64(it.ChrtID), "track_number": it.TrackNumber, "price": int64(it.Price), "rid": it.Rid,
+			"name": it.Name, "sale": int64(it.Sale), "size": it.Size, "total_price": int64(it.TotalPrice),
+			"nm_id": int64(it.NmID), "brand": it.Brand, "status": int64(it.Status),
+		})
+	}
+	record := map[string]any{
+		"order_uid":    o.OrderUID,
+		"track_number": o.TrackNumber,
+		"entry":        o.Entry,
+		"delivery": map[string]any{
+			"name": o.Delivery.Name, "phone": o.Delivery.Phone, "zip": o.Delivery.Zip, "city": o.Delivery.City,
+			"address": o.Delivery.Address, "region": o.Delivery.Region, "email": o.Delivery.Email,
+		},
+		"payment": map[string]any{
+			"transaction": o.Payment.Transaction, "request_id": o.Payment.RequestID, "currency": o.Payment.Currency,
+			"provider": o.Payment.Provider, "amount": int64(o.Payment.Amount), "payment_dt": int64(o.Payment.PaymentDT),
+			"bank": o.Payment.Bank, "delivery_cost": int64(o.Payment.DeliveryCost), "goods_total": int64(o.Payment.GoodsTotal),
+			"custom_fee": int64(o.Payment.CustomFee),
+		},
+		"items":              items,
+		"locale":             o.Locale,
+		"internal_signature": o.InternalSignature,
+		"customer_id":        o.CustomerID,
+		"delivery_service":   o.DeliveryService,
+		"shardkey":           o.ShardKey,
+		"sm_id":              int64(o.SmID),
+		"date_created":       o.DateCreated,
+		"oof_shard":          o.OofShard,
+	}
+
+	data, err := avro.Marshal(avro.MustParse(OrderAvroSchema), record)
+	if err != nil {
+		t.Fatalf("кодирование Avro: %v", err)
+	}
+	frame := []byte{avroMagicByte, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(frame[1:], uint32(schemaID))
+	return append(frame, data...)
+}
+
+func TestProtobufDecoderRoundTrip(t *testing.T) {
+	want := testOrder()
+	got, err := ProtobufDecoder{}.Decode(encodeProtoOrder(want))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("заказ после декодирования не совпадает:\n got: %+v\nwant: %+v", got, want)
+	}
+}
+
+func TestAvroDecoderRoundTrip(t *testing.T) {
+	registry := NewSchemaRegistry()
+	id, err := registry.Register(OrderSubject, OrderAvroSchema)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	want := testOrder()
+	got, err := (&AvroDecoder{Registry: registry}).Decode(encodeAvroOrder(t, id, want))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("заказ после декодирования не совпадает:\n got: %+v\nwant: %+v", got, want)
+	}
+
+	if _, err := (&AvroDecoder{Registry: registry}).Decode(encodeAvroOrder(t, id+1, want)); !errors.Is(err, ErrSchemaNotFound) {
+		t.Errorf("Decode с незарегистрированной схемой: ошибка %v, ожидается ErrSchemaNotFound", err)
+	}
+}
+
+func TestDecodeMessageValidatesBinaryFormats(t *testing.T) {
+	validator, err := validation.NewOrderValidator()
+	if err != nil {
+		t.Fatalf("NewOrderValidator: %v", err)
+	}
+	consumer := &Consumer{Validator: validator, Decoders: NewOrderDecoders(NewSchemaRegistry())}
+	protobuf := []kafka.Header{{Key: HeaderContentType, Value: []byte(ContentTypeProtobuf)}}
+
+	order := testOrder()
+	if _, stage, err := consumer.decodeMessage(kafka.Message{Value: encodeProtoOrder(order), Headers: protobuf}); err != nil {
+		t.Fatalf("корректный заказ отклонен на этапе %s: %v", stage, err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(order *model.Order)
+		fields []string // поля, для которых ожидаются ошибки (nil - заказ принимается)
+	}{
+		// пропущенное поле получает нулевое значение и отклоняется, если оно недопустимо по схеме
+		{"нет order_uid", func(o *model.Order) { o.OrderUID = "" }, []string{"/order_uid"}},
+		{"нет товаров и валюты", func(o *model.Order) {
+			o.Items = nil
+			o.Payment.Currency = ""
+		}, []string{"/items", "/payment/currency"}},
+		{"некорректный телефон", func(o *model.Order) { o.Delivery.Phone = "phone" }, []string{"/delivery/phone"}},
+		// наличие полей не проверяется: пропущенный bank неотличим от пустой строки, которая допустима схемой
+		{"нет bank", func(o *model.Order) { o.Payment.Bank = "" }, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := testOrder()
+			tt.modify(&order)
+			_, stage, err := consumer.decodeMessage(kafka.Message{Value: encodeProtoOrder(order), Headers: protobuf})
+			if tt.fields == nil {
+				if err != nil {
+					t.Fatalf("заказ отклонен на этапе %s: %v", stage, err)
+				}
+				return
+			}
+
+			var validationErr *validation.ValidationError
+			if stage != StageValidate || !errors.As(err, &validationErr) {
+				t.Fatalf("этап %q, ошибка %v; ожидается ошибка валидации", stage, err)
+			}
+			var fields []string
+			for _, fieldErr := range validationErr.Errors {
+				if !slices.Contains(fields, fieldErr.Field) {
+					fields = append(fields, fieldErr.Field)
+				}
+			}
+			if !slices.Equal(fields, tt.fields) {
+				t.Errorf("ошибки в полях %v, ожидаются %v: %v", fields, tt.fields, err)
+			}
+		})
+	}
+}
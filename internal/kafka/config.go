@@ -0,0 +1,326 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// структура настроек подключения к Kafka
+// значения читаются из переменных окружения функцией LoadConfig и проверяются при старте сервиса
+type Config struct {
+	Brokers []string // адреса брокеров
+
+	Topic           string // топик с заказами
+	EventsTopic     string // топик событий о заказах (outbox)
+	DeadLetterTopic string // топик для необработанных сообщений
+	TopicPartitions int    // количество партиций при создании топиков
+
+	// идентификатор клиента, передаваемый брокерам (client id) для логов и квот;
+	// партиции читаются напрямую со смещениями из БД, поэтому группа консьюмеров Kafka не используется
+	// и настроек группы (group id, session и heartbeat таймаутов) нет
+	ClientID string
+
+	MinBytes    int           // минимальный размер ответа на запрос чтения
+	MaxBytes    int           // максимальный размер ответа на запрос чтения
+	MaxWait     time.Duration // максимальное ожидание накопления MinBytes
+	StartOffset int64         // смещение, с которого читается партиция без сохраненного смещения (kafka.FirstOffset или kafka.LastOffset)
+
+	Workers      int           // количество параллельных обработчиков сообщений партиции (1 - последовательная обработка)
+	BatchSize    int           // максимальное количество сообщений в пакете (больше 1 - пакетный режим)
+	BatchTimeout time.Duration // максимальное время ожидания заполнения пакета
+
+	DialTimeout  time.Duration      // таймаут подключения к брокеру
+	ReadTimeout  time.Duration      // таймаут ответа брокера писателю
+	WriteTimeout time.Duration      // таймаут записи писателем
+	RequiredAcks kafka.RequiredAcks // подтверждения записи от реплик
+
+	TLS  *tls.Config    // настройки TLS (nil - соединение без шифрования)
+	SASL sasl.Mechanism // механизм аутентификации SASL (nil - без аутентификации)
+}
+
+// функция для загрузки настроек Kafka из переменных окружения
+// незаданные переменные получают значения по умолчанию, соответствующие docker-compose
+// возвращаемое значение: настройки и ошибка, если значение переменной некорректно или настройки не прошли проверку
+func LoadConfig() (Config, error) {
+	cfg := Config{
+		Brokers:         splitList(getEnv("KAFKA_BROKERS", "wb-kafka:9092")),
+		Topic:           getEnv("KAFKA_TOPIC", "orders"),
+		EventsTopic:     getEnv("KAFKA_EVENTS_TOPIC", "order-events"),
+		DeadLetterTopic: getEnv("KAFKA_DLQ_TOPIC", "orders-dlq"),
+		ClientID:        getEnv("KAFKA_CLIENT_ID", "order-consumer"),
+	}
+
+	// переменные группы консьюмеров прежних версий не применяются, о чем предупреждаем, а не молча их пропускаем
+	if groupID := os.Getenv("KAFKA_GROUP_ID"); groupID != "" {
+		log.Printf("[KAFKA] KAFKA_GROUP_ID не используется: группа консьюмеров не применяется, смещения хранятся в БД")
+		if os.Getenv("KAFKA_CLIENT_ID") == "" {
+			cfg.ClientID = groupID // сохраняем прежний client id, под которым клиент виден брокерам
+		}
+	}
+	for _, key := range []string{"KAFKA_SESSION_TIMEOUT", "KAFKA_HEARTBEAT_INTERVAL"} {
+		if os.Getenv(key) != "" {
+			log.Printf("[KAFKA] %s не используется: группа консьюмеров не применяется", key)
+		}
+	}
+
+	var errs []error
+	parseInt := func(key string, fallback int) int {
+		value, err := strconv.Atoi(getEnv(key, strconv.Itoa(fallback)))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+		return value
+	}
+	parseDuration := func(key string, fallback time.Duration) time.Duration {
+		value, err := time.ParseDuration(getEnv(key, fallback.String()))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+		return value
+	}
+
+	cfg.TopicPartitions = parseInt("KAFKA_TOPIC_PARTITIONS", 1)
+	cfg.MinBytes = parseInt("KAFKA_MIN_BYTES", 1)
+	cfg.MaxBytes = parseInt("KAFKA_MAX_BYTES", 10e6)
+	cfg.MaxWait = parseDuration("KAFKA_MAX_WAIT", 10*time.Second)
+	cfg.DialTimeout = parseDuration("KAFKA_DIAL_TIMEOUT", 10*time.Second)
+	cfg.ReadTimeout = parseDuration("KAFKA_READ_TIMEOUT", 10*time.Second)
+	cfg.WriteTimeout = parseDuration("KAFKA_WRITE_TIMEOUT", 10*time.Second)
+	cfg.Workers = parseInt("KAFKA_WORKERS", 1)
+	cfg.BatchSize = parseInt("KAFKA_BATCH_SIZE", 1)
+	cfg.BatchTimeout = parseDuration("KAFKA_BATCH_TIMEOUT", 500*time.Millisecond)
+
+	switch offset := getEnv("KAFKA_START_OFFSET", "first"); offset {
+	case "first":
+		cfg.StartOffset = kafka.FirstOffset
+	case "last":
+		cfg.StartOffset = kafka.LastOffset
+	default:
+		errs = append(errs, fmt.Errorf("KAFKA_START_OFFSET: ожидается first или last, получено %q", offset))
+	}
+
+	switch acks := getEnv("KAFKA_ACKS", "all"); acks {
+	case "all":
+		cfg.RequiredAcks = kafka.RequireAll
+	case "one":
+		cfg.RequiredAcks = kafka.RequireOne
+	case "none":
+		cfg.RequiredAcks = kafka.RequireNone
+	default:
+		errs = append(errs, fmt.Errorf("KAFKA_ACKS: ожидается all, one или none, получено %q", acks))
+	}
+
+	tlsConfig, err := loadTLSConfig()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.TLS = tlsConfig
+
+	mechanism, err := loadSASLMechanism()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.SASL = mechanism
+	if cfg.SASL != nil && cfg.SASL.Name() == "PLAIN" && cfg.TLS == nil {
+		log.Printf("[KAFKA] SASL PLAIN без TLS: пароль передается брокеру в открытом виде")
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// функция для загрузки настроек TLS из переменных окружения
+// KAFKA_TLS_CA_FILE задает собственный корневой сертификат, KAFKA_TLS_CERT_FILE и KAFKA_TLS_KEY_FILE - клиентский сертификат
+// возвращаемое значение: настройки TLS (nil, если TLS выключен) и ошибка, если сертификаты не загружены
+func loadTLSConfig() (*tls.Config, error) {
+	caFile := os.Getenv("KAFKA_TLS_CA_FILE")
+	certFile := os.Getenv("KAFKA_TLS_CERT_FILE")
+	keyFile := os.Getenv("KAFKA_TLS_KEY_FILE")
+
+	// TLS включается явно или заданием любого из сертификатов
+	if os.Getenv("KAFKA_TLS_ENABLED") != "true" && caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         os.Getenv("KAFKA_TLS_SERVER_NAME"),
+		InsecureSkipVerify: os.Getenv("KAFKA_TLS_INSECURE_SKIP_VERIFY") == "true", // только для тестовых кластеров
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("KAFKA_TLS_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("KAFKA_TLS_CA_FILE: в файле %s нет сертификатов в формате PEM", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("KAFKA_TLS_CERT_FILE и KAFKA_TLS_KEY_FILE задаются только вместе")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("клиентский сертификат: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// функция для создания механизма аутентификации SASL из переменных окружения
+// поддерживаются PLAIN, SCRAM-SHA-256 и SCRAM-SHA-512
+// возвращаемое значение: механизм (nil, если аутентификация выключена) и ошибка, если настройки некорректны
+func loadSASLMechanism() (sasl.Mechanism, error) {
+	name := strings.ToUpper(os.Getenv("KAFKA_SASL_MECHANISM"))
+	if name == "" {
+		return nil, nil
+	}
+
+	username, password := os.Getenv("KAFKA_SASL_USERNAME"), os.Getenv("KAFKA_SASL_PASSWORD")
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("для SASL %s нужно задать KAFKA_SASL_USERNAME и KAFKA_SASL_PASSWORD", name)
+	}
+
+	switch name {
+	case "PLAIN":
+		return plain.Mechanism{Username: username, Password: password}, nil
+	case "SCRAM-SHA-256":
+		return scram.Mechanism(scram.SHA256, username, password)
+	case "SCRAM-SHA-512":
+		return scram.Mechanism(scram.SHA512, username, password)
+	default:
+		return nil, fmt.Errorf("KAFKA_SASL_MECHANISM: ожидается PLAIN, SCRAM-SHA-256 или SCRAM-SHA-512, получено %q", name)
+	}
+}
+
+// функция для проверки настроек Kafka
+// возвращаемое значение: ошибка со всеми найденными проблемами
+func (cfg Config) Validate() error {
+	var errs []error
+	if len(cfg.Brokers) == 0 {
+		errs = append(errs, errors.New("не задан ни один брокер"))
+	}
+	for _, broker := range cfg.Brokers {
+		if _, _, err := net.SplitHostPort(broker); err != nil {
+			errs = append(errs, fmt.Errorf("некорректный адрес брокера %q: %w", broker, err))
+		}
+	}
+
+	topics := map[string]string{"топик заказов": cfg.Topic, "топик событий": cfg.EventsTopic, "dead-letter топик": cfg.DeadLetterTopic}
+	seen := make(map[string]bool)
+	for name, topic := range topics {
+		if topic == "" {
+			errs = append(errs, fmt.Errorf("не задан %s", name))
+			continue
+		}
+		if seen[topic] {
+			errs = append(errs, fmt.Errorf("топик %q используется для разных целей", topic))
+		}
+		seen[topic] = true
+	}
+	if cfg.TopicPartitions < 1 {
+		errs = append(errs, fmt.Errorf("количество партиций должно быть положительным: %d", cfg.TopicPartitions))
+	}
+
+	if cfg.MinBytes < 1 {
+		errs = append(errs, fmt.Errorf("минимальный размер ответа должен быть положительным: %d", cfg.MinBytes))
+	}
+	if cfg.MaxBytes < cfg.MinBytes {
+		errs = append(errs, fmt.Errorf("максимальный размер ответа (%d) меньше минимального (%d)", cfg.MaxBytes, cfg.MinBytes))
+	}
+	if cfg.StartOffset != kafka.FirstOffset && cfg.StartOffset != kafka.LastOffset {
+		errs = append(errs, fmt.Errorf("некорректное начальное смещение: %d", cfg.StartOffset))
+	}
+	if cfg.Workers < 1 {
+		errs = append(errs, fmt.Errorf("количество обработчиков должно быть положительным: %d", cfg.Workers))
+	}
+	if cfg.BatchSize < 1 {
+		errs = append(errs, fmt.Errorf("размер пакета должен быть положительным: %d", cfg.BatchSize))
+	}
+
+	for name, timeout := range map[string]time.Duration{"ожидание чтения": cfg.MaxWait, "таймаут подключения": cfg.DialTimeout, "таймаут ответа": cfg.ReadTimeout, "таймаут записи": cfg.WriteTimeout, "ожидание пакета": cfg.BatchTimeout} {
+		if timeout <= 0 {
+			errs = append(errs, fmt.Errorf("%s должен быть положительным: %s", name, timeout))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// функция для создания подключения к брокерам с настройками из конфигурации (включая TLS и SASL)
+// используется ридерами консьюмера и служебными соединениями (создание топиков, ожидание Kafka)
+// возвращаемое значение: указатель на kafka.Dialer
+func (cfg Config) Dialer() *kafka.Dialer {
+	return &kafka.Dialer{
+		ClientID:      cfg.ClientID,
+		Timeout:       cfg.DialTimeout,
+		DualStack:     true,
+		TLS:           cfg.TLS,
+		SASLMechanism: cfg.SASL,
+	}
+}
+
+// время накопления пачки сообщений писателем; значение по умолчанию (1 с) задерживает каждый синхронный вызов WriteMessages
+const writerBatchTimeout = 10 * time.Millisecond
+
+// функция для создания писателя в указанный топик с настройками подключения из конфигурации (включая TLS и SASL)
+// сообщения с одинаковым ключом попадают в одну партицию
+// возвращаемое значение: указатель на kafka.Writer
+func (cfg Config) NewWriter(topic string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: writerBatchTimeout,
+		RequiredAcks: cfg.RequiredAcks,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		Transport: &kafka.Transport{
+			ClientID:    cfg.ClientID,
+			DialTimeout: cfg.DialTimeout,
+			TLS:         cfg.TLS,
+			SASL:        cfg.SASL,
+		},
+	}
+}
+
+// функция для получения значения переменной окружения
+// возвращаемое значение: значение переменной или значение по умолчанию, если переменная не задана
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// функция для разбора списка значений через запятую
+// возвращаемое значение: непустые значения без пробелов
+func splitList(value string) []string {
+	var result []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
@@ -0,0 +1,117 @@
+package kafka
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// корректные настройки, от которых отталкиваются проверки Validate
+func validConfig() Config {
+	return Config{
+		Brokers:         []string{"kafka-1:9092", "kafka-2:9092"},
+		Topic:           "orders",
+		EventsTopic:     "order-events",
+		DeadLetterTopic: "orders-dlq",
+		TopicPartitions: 3,
+		MinBytes:        1,
+		MaxBytes:        10e6,
+		MaxWait:         time.Second,
+		StartOffset:     kafka.FirstOffset,
+		Workers:         1,
+		BatchSize:       1,
+		BatchTimeout:    time.Second,
+		DialTimeout:     time.Second,
+		ReadTimeout:     time.Second,
+		WriteTimeout:    time.Second,
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("корректные настройки отклонены: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+		want   string // фрагмент текста ошибки
+	}{
+		{"нет брокеров", func(cfg *Config) { cfg.Brokers = nil }, "не задан ни один брокер"},
+		{"брокер без порта", func(cfg *Config) { cfg.Brokers = []string{"kafka-1"} }, `некорректный адрес брокера "kafka-1"`},
+		{"нет топика заказов", func(cfg *Config) { cfg.Topic = "" }, "не задан топик заказов"},
+		{"один топик для разных целей", func(cfg *Config) { cfg.DeadLetterTopic = cfg.Topic }, `топик "orders" используется для разных целей`},
+		{"нет партиций", func(cfg *Config) { cfg.TopicPartitions = 0 }, "количество партиций должно быть положительным"},
+		{"нулевой MinBytes", func(cfg *Config) { cfg.MinBytes = 0 }, "минимальный размер ответа должен быть положительным"},
+		{"MaxBytes меньше MinBytes", func(cfg *Config) { cfg.MinBytes, cfg.MaxBytes = 100, 10 }, "меньше минимального"},
+		{"неизвестное начальное смещение", func(cfg *Config) { cfg.StartOffset = 5 }, "некорректное начальное смещение"},
+		{"нулевой таймаут подключения", func(cfg *Config) { cfg.DialTimeout = 0 }, "таймаут подключения должен быть положительным"},
+		{"отрицательное ожидание чтения", func(cfg *Config) { cfg.MaxWait = -time.Second }, "ожидание чтения должен быть положительным"},
+		{"нет обработчиков", func(cfg *Config) { cfg.Workers = 0 }, "количество обработчиков должно быть положительным"},
+		{"нулевой размер пакета", func(cfg *Config) { cfg.BatchSize = 0 }, "размер пакета должен быть положительным"},
+		{"нулевое ожидание пакета", func(cfg *Config) { cfg.BatchTimeout = 0 }, "ожидание пакета должен быть положительным"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(&cfg)
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate: ошибка %v, ожидается ошибка с %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigValidateReportsAllProblems(t *testing.T) {
+	cfg := validConfig()
+	cfg.Brokers = nil
+	cfg.TopicPartitions = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate: ожидается ошибка")
+	}
+	for _, want := range []string{"не задан ни один брокер", "количество партиций"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("ошибка %q не содержит %q", err, want)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("KAFKA_WORKERS", "4")
+	t.Setenv("KAFKA_BATCH_SIZE", "100")
+	t.Setenv("KAFKA_BATCH_TIMEOUT", "2s")
+	t.Setenv("KAFKA_GROUP_ID", "legacy-group")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.Workers != 4 || cfg.BatchSize != 100 || cfg.BatchTimeout != 2*time.Second {
+		t.Errorf("обработчики %d, пакет %d, ожидание %s; ожидаются 4, 100, 2s", cfg.Workers, cfg.BatchSize, cfg.BatchTimeout)
+	}
+	if cfg.ClientID != "legacy-group" {
+		t.Errorf("client id %q, ожидается значение прежней переменной KAFKA_GROUP_ID", cfg.ClientID)
+	}
+}
+
+func TestLoadConfigFailsOnInvalidValues(t *testing.T) {
+	t.Setenv("KAFKA_WORKERS", "много")
+	t.Setenv("KAFKA_BATCH_SIZE", "0")
+	t.Setenv("KAFKA_BATCH_TIMEOUT", "500")
+
+	_, err := LoadConfig()
+	if err == nil {
+		t.Fatal("LoadConfig: ожидается ошибка")
+	}
+	for _, want := range []string{"KAFKA_WORKERS", "KAFKA_BATCH_TIMEOUT"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("ошибка %q не содержит %q", err, want)
+		}
+	}
+}
@@ -2,76 +2,391 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"strconv"
+	"sync"
 	"time"
 
 	"wb-tech-test/internal/cache"
 	"wb-tech-test/internal/db"
 	"wb-tech-test/internal/model"
+	"wb-tech-test/internal/validation"
 
 	"github.com/segmentio/kafka-go"
 )
 
 // структура для консьюмера
+// смещения хранятся в Postgres вместе с заказами, поэтому консьюмер читает партиции напрямую,
+// без группы консьюмеров, начиная с сохраненных в БД смещений
 type Consumer struct {
-	Reader *kafka.Reader     // ридер сообщений из Kafka
-	DB     *db.DB            // БД
-	Cache  *cache.OrderCache // кеш
+	Config  Config            // настройки подключения и чтения
+	Brokers []string          // адреса брокеров Kafka
+	Topic   string            // топик с заказами
+	Readers []*kafka.Reader   // ридеры сообщений из Kafka, по одному на партицию
+	DB      db.OrderStore     // хранилище заказов
+	Cache   *cache.OrderCache // кеш
+	Workers int               // количество параллельных обработчиков сообщений партиции (1 - последовательная обработка)
+
+	BatchSize    int           // максимальное количество сообщений в пакете (больше 1 - пакетный режим, только для Postgres)
+	BatchTimeout time.Duration // максимальное время ожидания заполнения пакета
+
+	DeadLetter *DeadLetterPublisher       // издатель необработанных сообщений (nil - такие сообщения только логируются)
+	Validator  *validation.OrderValidator // валидатор JSON-сообщений по JSON Schema (nil - сообщения не проверяются)
+	Decoders   map[string]OrderDecoder    // декодеры по формату из заголовка content-type (nil - только JSON)
+	Metrics    *Metrics                   // метрики обработки (nil - метрики не собираются)
+
+	mu sync.Mutex // защищает Readers от одновременного изменения и чтения метриками
 }
 
-const (
-	groupID = "order-consumer-group" // группа консьюмеров
-)
+// заголовок сообщения с версией схемы заказа (если не задан, используется текущая версия)
+const HeaderSchemaVersion = "schema-version"
+
+// интервал проверки добавленных партиций топика
+const partitionCheckInterval = time.Minute
 
-// функция для создания нового консьюмера
-func NewConsumer(brokers []string, topic string, db *db.DB, cache *cache.OrderCache) *Consumer {
+// функция для создания нового консьюмера топика заказов из настроек
+func NewConsumer(cfg Config, db db.OrderStore, cache *cache.OrderCache) *Consumer {
 	return &Consumer{
-		Reader: kafka.NewReader(kafka.ReaderConfig{
-			Brokers: brokers,
-			Topic:   topic,
-			GroupID: groupID,
-		}),
-		DB:    db,
-		Cache: cache,
+		Config:  cfg,
+		Brokers: cfg.Brokers,
+		Topic:   cfg.Topic,
+		DB:      db,
+		Cache:   cache,
+
+		Workers:      cfg.Workers,
+		BatchSize:    cfg.BatchSize,
+		BatchTimeout: cfg.BatchTimeout,
 	}
 }
 
-// функция для чтения сообщений из Kafka
-func (c *Consumer) Consume() {
-	var order model.Order // создаем экземпляр структуры Order
+// функция для чтения сообщений из Kafka до отмены контекста
+// для каждой партиции топика запускается отдельный ридер, начинающий чтение с сохраненного в БД смещения;
+// список партиций периодически перечитывается, и для добавленных партиций запускаются новые ридеры.
+// После отмены контекста обрабатываемые сообщения дообрабатываются и их смещения сохраняются, затем функция возвращает управление
+// возвращаемое значение: ошибка, если ридеры не созданы
+func (c *Consumer) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	known := make(map[int]bool) // партиции, для которых уже запущены ридеры
+	if err := c.startPartitions(ctx, &wg, known, c.Config.StartOffset); err != nil {
+		log.Printf("[KAFKA] Ошибка при создании ридеров: %v", err)
+		return err
+	}
 
-	for {
-		msg, err := c.Reader.ReadMessage(context.Background()) // читаем сообщение из Kafka
+	ticker := time.NewTicker(partitionCheckInterval)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+			// добавленные партиции читаются с начала: сообщения в них могли появиться до обнаружения партиции
+			if err := c.startPartitions(ctx, &wg, known, kafka.FirstOffset); err != nil {
+				log.Printf("[KAFKA] Ошибка при проверке партиций топика %s: %v", c.Topic, err)
+			}
+		}
+	}
+
+	wg.Wait()
+	log.Printf("[KAFKA] Чтение топика %s остановлено", c.Topic)
+	return nil
+}
+
+// функция для запуска чтения партиций топика, для которых еще нет ридеров
+// startOffset используется для партиций без сохраненного в БД смещения
+// возвращаемое значение: ошибка, если партиции не получены или ридер не создан
+func (c *Consumer) startPartitions(ctx context.Context, wg *sync.WaitGroup, known map[int]bool, startOffset int64) error {
+	partitions, err := readPartitions(c.Config.Dialer(), c.Brokers, c.Topic)
+	if err != nil {
+		return err
+	}
+
+	var added []int
+	for _, partition := range partitions {
+		if !known[partition] {
+			added = append(added, partition)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	offsets, err := c.DB.GetKafkaOffsets(ctx, c.Topic)
+	if err != nil {
+		return err
+	}
+
+	for _, partition := range added {
+		offset, ok := offsets[partition]
+		if !ok {
+			offset = startOffset // смещение еще не сохранено - читаем партицию с начала или с конца
+		}
+		reader, err := c.openReader(partition, offset)
 		if err != nil {
-			log.Printf("[KAFKA] Ошибка чтения сообщения: %v", err)
-			continue
+			return err
 		}
+		known[partition] = true
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.consumePartition(ctx, reader)
+		}()
+	}
+	return nil
+}
 
-		// десериализуем сообщение в структуру Order
-		if err := json.Unmarshal(msg.Value, &order); err != nil {
-			log.Printf("[KAFKA] Ошибка десериализации сообщения: %v", err)
+// функция для закрытия ридеров и издателя dead-letter топика
+// вызывается после завершения Run
+// возвращаемое значение: первая ошибка закрытия
+func (c *Consumer) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for _, reader := range c.Readers {
+		errs = append(errs, reader.Close())
+	}
+	c.Readers = nil
+	if c.DeadLetter != nil {
+		errs = append(errs, c.DeadLetter.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// функция для получения текущих ридеров
+// возвращаемое значение: копия слайса ридеров
+func (c *Consumer) readers() []*kafka.Reader {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*kafka.Reader(nil), c.Readers...)
+}
+
+// функция для создания ридера партиции, начинающего чтение с указанного смещения
+// возвращаемое значение: ридер и ошибка, если смещение не установлено
+func (c *Consumer) openReader(partition int, offset int64) (*kafka.Reader, error) {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   c.Brokers,
+		Topic:     c.Topic,
+		Partition: partition,
+		Dialer:    c.Config.Dialer(),
+		MinBytes:  c.Config.MinBytes,
+		MaxBytes:  c.Config.MaxBytes,
+		MaxWait:   c.Config.MaxWait,
+	})
+	if err := reader.SetOffset(offset); err != nil {
+		reader.Close()
+		return nil, err
+	}
+	log.Printf("[KAFKA] Чтение партиции %d топика %s со смещения %d", partition, c.Topic, offset)
+
+	c.mu.Lock()
+	c.Readers = append(c.Readers, reader)
+	c.mu.Unlock()
+	return reader, nil
+}
+
+// функция для чтения сообщений из одной партиции до отмены контекста
+// при временной ошибке сохранения ридер возвращается к необработанному сообщению и повторяет попытку
+// с экспоненциальной задержкой, блокируя партицию, поэтому заказ не теряется
+func (c *Consumer) consumePartition(ctx context.Context, reader *kafka.Reader) {
+	if c.BatchSize > 1 {
+		if store, ok := c.DB.(db.BatchOrderStore); ok {
+			c.consumePartitionBatches(ctx, reader, store)
+			return
+		}
+		log.Printf("[KAFKA] Хранилище не поддерживает пакетное сохранение, сообщения обрабатываются по одному")
+	}
+	if c.Workers > 1 {
+		c.consumePartitionConcurrently(ctx, reader)
+		return
+	}
+
+	attempt := 1 // номер попытки обработки текущего сообщения
+	for {
+		msg, ok := fetchMessage(ctx, reader)
+		if !ok {
+			return // консьюмер остановлен
+		}
+
+		// полученное сообщение дообрабатывается даже после отмены контекста,
+		// чтобы заказ и смещение были сохранены в одной транзакции
+		if err := c.handleMessage(context.WithoutCancel(ctx), msg, attempt); err != nil {
+			delay := retryBackoff(attempt)
+			attempt++
+			log.Printf("[KAFKA] Повторная обработка сообщения %d из партиции %d через %s (попытка %d)", msg.Offset, msg.Partition, delay, attempt)
+			if !sleepContext(ctx, delay) {
+				return
+			}
+			if err := reader.SetOffset(msg.Offset); err != nil {
+				log.Printf("[KAFKA] Ошибка возврата к смещению %d: %v", msg.Offset, err)
+			}
 			continue
 		}
+		attempt = 1
+	}
+}
+
+// функция для обработки одного сообщения из Kafka
+// сообщения с постоянными ошибками отправляются в dead-letter топик, при временных ошибках сообщение обрабатывается повторно
+// возвращаемое значение: ошибка, если сообщение нужно обработать повторно
+func (c *Consumer) handleMessage(ctx context.Context, msg kafka.Message, attempt int) error {
+	start := time.Now()
+	defer c.Metrics.observeLatency(msg.Topic, msg.Partition, start)
+
+	source := sourceMessage(msg)
+	source.DeferOffset = c.Workers > 1 // при параллельной обработке смещение сохраняет offsetTracker
+
+	// проверяем сообщение по схеме заказа и десериализуем его декодером, выбранным по формату сообщения
+	// некорректное сообщение не станет корректным при повторе, поэтому сразу пропускается
+	order, stage, err := c.decodeMessage(msg)
+	if err != nil {
+		log.Printf("[KAFKA] Сообщение %d из партиции %d не обработано (%s): %v", msg.Offset, msg.Partition, stage, err)
+		return c.skipMessage(ctx, msg, source, stage, err, attempt)
+	}
 
-		// выводим информацию о полученном заказе
+	order.Status = model.StatusCreated // новый заказ всегда начинает жизненный цикл со статуса created
+
+	// выводим информацию о полученном заказе (двоичные форматы не выводятся как текст)
+	if format := contentType(msg); format == ContentTypeJSON {
 		log.Printf("[KAFKA] Получен заказ %s с сообщением: %s", order.OrderUID, string(msg.Value))
+	} else {
+		log.Printf("[KAFKA] Получен заказ %s с сообщением %s, %d байт", order.OrderUID, format, len(msg.Value))
+	}
 
-		// сохраняем заказ в БД и кеш
-		if err := c.ProcessOrder(order); err != nil {
-			log.Printf("[KAFKA] Ошибка сохранения заказа: %v", err)
-			continue
+	// сохраняем заказ вместе со смещением сообщения в БД и кеш
+	err = c.DB.SaveOrderFromMessage(ctx, order, source)
+	if errors.Is(err, db.ErrOrderExists) {
+		// повторная доставка (после перезапуска или возврата к смещению) - штатная ситуация, а не ошибка
+		log.Printf("[KAFKA] Заказ %s уже сохранен, пропускаем сообщение: %v", order.OrderUID, err)
+		return c.skipDuplicate(ctx, msg, source)
+	}
+	if err != nil {
+		log.Printf("[KAFKA] Ошибка сохранения заказа: %v", err)
+		if db.IsTransient(err) {
+			c.Metrics.addError(msg.Topic, msg.Partition, stageRetry)
+			return err // временная ошибка (соединение, таймаут, сериализация) - повторяем
 		}
+		return c.skipMessage(ctx, msg, source, StageSave, err, attempt) // постоянная ошибка - повтор не поможет
+	}
+	c.Cache.Set(order)
+	c.Metrics.addProcessed(msg.Topic, msg.Partition, resultSaved, 1)
+	return nil
+}
+
+// функция для проверки заказа в JSON по версии схемы заказа из заголовка schema-version
+// возвращаемое значение: ошибка со списком ошибок по полям, если заказ не соответствует схеме
+func (c *Consumer) validate(msg kafka.Message, data []byte) error {
+	if c.Validator == nil {
+		return nil
+	}
+	var version string
+	for _, header := range msg.Headers {
+		if header.Key == HeaderSchemaVersion {
+			version = string(header.Value)
+		}
+	}
+	return c.Validator.ValidateVersion(version, data)
+}
+
+// функция для получения этапа, на котором отклонено сообщение, не прошедшее проверку по схеме
+// некорректный JSON отклоняется на этапе StageDecode, как и неразобранное тело двоичного формата
+// возвращаемое значение: StageDecode, если тело не разобрано, иначе StageValidate
+func validationStage(err error) string {
+	if errors.Is(err, validation.ErrMalformedJSON) {
+		return StageDecode
+	}
+	return StageValidate
+}
+
+// функция для получения описания исходного сообщения для сохранения в БД
+// возвращаемое значение: структура SourceMessage
+func sourceMessage(msg kafka.Message) db.SourceMessage {
+	return db.SourceMessage{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Time:      msg.Time,
+
+		ContentType: contentType(msg),
+	}
+}
+
+// функция для пропуска сообщения, которое не удается обработать
+// сообщение публикуется в dead-letter топик (если он задан), после чего его смещение сохраняется
+// (при параллельной обработке смещение сохраняет offsetTracker)
+// возвращаемое значение: ошибка, если сообщение не опубликовано или смещение не сохранено (сообщение будет обработано повторно)
+func (c *Consumer) skipMessage(ctx context.Context, msg kafka.Message, source db.SourceMessage, stage string, reason error, attempt int) error {
+	c.Metrics.addError(msg.Topic, msg.Partition, stage)
+	if c.DeadLetter != nil {
+		if err := c.DeadLetter.Publish(ctx, msg, stage, reason, attempt); err != nil {
+			return err
+		}
+	}
+	if !source.DeferOffset {
+		if err := c.DB.SaveKafkaOffset(ctx, source); err != nil {
+			return err
+		}
+	}
+	c.Metrics.addProcessed(msg.Topic, msg.Partition, resultSkipped, 1)
+	return nil
+}
+
+// функция для пропуска повторно доставленного сообщения с уже сохраненным заказом
+// сообщение не публикуется в dead-letter топик, сохраняется только его смещение
+// (при параллельной обработке смещение сохраняет offsetTracker)
+// возвращаемое значение: ошибка, если смещение не сохранено (сообщение будет обработано повторно)
+func (c *Consumer) skipDuplicate(ctx context.Context, msg kafka.Message, source db.SourceMessage) error {
+	if !source.DeferOffset {
+		if err := c.DB.SaveKafkaOffset(ctx, source); err != nil {
+			return err
+		}
+	}
+	c.Metrics.addProcessed(msg.Topic, msg.Partition, resultSkipped, 1)
+	return nil
+}
+
+// функция для проверки и декодирования сообщения так же, как при чтении топика
+// используется утилитой повторной обработки сообщений
+// возвращаемое значение: заказ и ошибка, если сообщение не прошло валидацию или не декодировано
+func (c *Consumer) DecodeMessage(msg kafka.Message) (model.Order, error) {
+	order, _, err := c.decodeMessage(msg)
+	return order, err
+}
 
+// функция для проверки, можно ли сохранить заказ, без сохранения (пробный прогон)
+// возвращаемое значение: ошибка db.ErrOrderExists, если заказ или транзакция оплаты уже сохранены, либо ошибка проверки
+func (c *Consumer) CheckOrder(ctx context.Context, order model.Order) error {
+	exists, err := c.DB.IsOrderExists(ctx, order.OrderUID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("заказ %s: %w", order.OrderUID, db.ErrOrderExists)
 	}
 
+	exists, err = c.DB.IsTransactionExists(ctx, order.Payment.Transaction)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("транзакция %s: %w", order.Payment.Transaction, db.ErrOrderExists)
+	}
+	return nil
 }
 
-// функция для обработки заказа (сохранение в БД и кеш)
-func (c *Consumer) ProcessOrder(order model.Order) error {
-	if err := c.DB.SaveOrder(context.Background(), order); err != nil {
+// функция для обработки заказа вне чтения топика (утилитой повторной обработки сообщений)
+// заказ сохраняется вместе с исходным сообщением так же, как при чтении топика, но смещение консьюмера не меняется
+// возвращаемое значение: ошибка, если заказ не сохранен (db.ErrOrderExists, если заказ уже сохранен)
+func (c *Consumer) ProcessOrder(ctx context.Context, order model.Order, msg kafka.Message) error {
+	order.Status = model.StatusCreated // новый заказ всегда начинает жизненный цикл со статуса created
+
+	source := sourceMessage(msg)
+	source.DeferOffset = true // смещения консьюмера сохраняются только при чтении топика
+	if err := c.DB.SaveOrderFromMessage(ctx, order, source); err != nil {
 		log.Printf("[KAFKA] Ошибка при сохранении заказа %s: %v", order.OrderUID, err)
 		return err
 	}
@@ -80,8 +395,8 @@ func (c *Consumer) ProcessOrder(order model.Order) error {
 }
 
 // функция для проверки существования топика в Kafka
-func EnsureTopicExists(broker, topic string, partitions int) error {
-	conn, err := kafka.Dial("tcp", broker) // создаем соединение с брокером Kafka
+func EnsureTopicExists(dialer *kafka.Dialer, brokers []string, topic string, partitions int) error {
+	conn, err := dialAny(dialer, brokers) // создаем соединение с первым доступным брокером Kafka
 	if err != nil {
 		return err
 	}
@@ -93,7 +408,7 @@ func EnsureTopicExists(broker, topic string, partitions int) error {
 		return err
 	}
 
-	controllerConn, err := kafka.Dial("tcp", controller.Host+":"+strconv.Itoa(controller.Port)) // создаем соединение с контроллером топика
+	controllerConn, err := dialer.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port))) // создаем соединение с контроллером топика
 
 	if err != nil {
 		return err
@@ -114,11 +429,49 @@ func EnsureTopicExists(broker, topic string, partitions int) error {
 	return nil
 }
 
+// функция для получения списка партиций топика заказов
+// возвращаемое значение: слайс номеров партиций и ошибка, если партиции не получены
+func (cfg Config) Partitions() ([]int, error) {
+	return readPartitions(cfg.Dialer(), cfg.Brokers, cfg.Topic)
+}
+
+// функция для получения смещения, которое получит следующее сообщение партиции топика заказов
+// возвращаемое значение: смещение конца партиции и ошибка, если смещение не получено
+func (cfg Config) LastOffset(ctx context.Context, partition int) (int64, error) {
+	conn, err := dialLeaderAny(ctx, cfg.Dialer(), cfg.Brokers, cfg.Topic, partition)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return conn.ReadLastOffset()
+}
+
+// функция для получения списка партиций топика
+// возвращаемое значение: слайс номеров партиций и ошибка, если партиции не получены
+func readPartitions(dialer *kafka.Dialer, brokers []string, topic string) ([]int, error) {
+	conn, err := dialAny(dialer, brokers) // создаем соединение с первым доступным брокером Kafka
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close() // закрываем соединение с брокером Kafka
+
+	partitions, err := conn.ReadPartitions(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(partitions))
+	for _, partition := range partitions {
+		ids = append(ids, partition.ID)
+	}
+	return ids, nil
+}
+
 // функция для ожидания доступности Kafka
 // возвращаемое значение: ошибка, если Kafka не доступна
-func WaitForKafka(brokers []string, topic string, maxRetries int, delay time.Duration) error {
+func WaitForKafka(dialer *kafka.Dialer, brokers []string, topic string, maxRetries int, delay time.Duration) error {
 	for i := range maxRetries {
-		conn, err := kafka.DialLeader(context.Background(), "tcp", brokers[0], topic, 0)
+		conn, err := dialLeaderAny(context.Background(), dialer, brokers, topic, 0)
 		if err == nil {
 			conn.Close()
 			log.Println("[MAIN] Kafka доступна!")
@@ -129,3 +482,31 @@ func WaitForKafka(brokers []string, topic string, maxRetries int, delay time.Dur
 	}
 	return fmt.Errorf("kafka не доступна после %d попыток", maxRetries)
 }
+
+// функция для подключения к первому доступному брокеру из списка
+// возвращаемое значение: соединение и ошибки подключения ко всем брокерам, если ни один не доступен
+func dialAny(dialer *kafka.Dialer, brokers []string) (*kafka.Conn, error) {
+	var errs []error
+	for _, broker := range brokers {
+		conn, err := dialer.Dial("tcp", broker)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", broker, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// функция для подключения к лидеру партиции через первый доступный брокер из списка
+// возвращаемое значение: соединение и ошибки подключения через все брокеры, если лидер не доступен
+func dialLeaderAny(ctx context.Context, dialer *kafka.Dialer, brokers []string, topic string, partition int) (*kafka.Conn, error) {
+	var errs []error
+	for _, broker := range brokers {
+		conn, err := dialer.DialLeader(ctx, "tcp", broker, topic, partition)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", broker, err))
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,39 @@
+package kafka
+
+import (
+	"testing"
+
+	"wb-tech-test/internal/validation"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestValidationStage(t *testing.T) {
+	validator, err := validation.NewOrderValidator()
+	if err != nil {
+		t.Fatalf("NewOrderValidator: %v", err)
+	}
+	consumer := &Consumer{Validator: validator}
+
+	tests := []struct {
+		name  string
+		value string
+		stage string
+	}{
+		{"некорректный JSON", `{"order_uid":`, StageDecode},
+		{"заказ не по схеме", `{"order_uid": ""}`, StageValidate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value := []byte(tt.value)
+			err := consumer.validate(kafka.Message{Value: value}, value)
+			if err == nil {
+				t.Fatal("validate: ожидается ошибка")
+			}
+			if stage := validationStage(err); stage != tt.stage {
+				t.Errorf("этап %q, ожидается %q: %v", stage, tt.stage, err)
+			}
+		})
+	}
+}
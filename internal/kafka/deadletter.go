@@ -0,0 +1,74 @@
+package kafka
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// этапы обработки сообщения, на которых может произойти ошибка
+const (
+	StageDecode   = "decode"   // десериализация сообщения
+	StageValidate = "validate" // проверка сообщения по JSON Schema заказа
+	StageSave     = "save"     // сохранение заказа в БД
+)
+
+// заголовки, добавляемые к сообщению в dead-letter топике
+const (
+	HeaderReason            = "dlq-reason"             // текст ошибки
+	HeaderStage             = "dlq-stage"              // этап обработки, на котором произошла ошибка
+	HeaderOriginalTopic     = "dlq-original-topic"     // исходный топик
+	HeaderOriginalPartition = "dlq-original-partition" // исходная партиция
+	HeaderOriginalOffset    = "dlq-original-offset"    // исходное смещение
+	HeaderAttempts          = "dlq-attempts"           // количество попыток обработки
+	HeaderFailedAt          = "dlq-failed-at"          // время последней ошибки (RFC3339)
+)
+
+// структура для публикации необработанных сообщений в dead-letter топик
+type DeadLetterPublisher struct {
+	Writer *kafka.Writer // писатель сообщений в dead-letter топик
+}
+
+// функция для создания нового издателя dead-letter сообщений в топик из настроек
+func NewDeadLetterPublisher(cfg Config) *DeadLetterPublisher {
+	return &DeadLetterPublisher{
+		Writer: cfg.NewWriter(cfg.DeadLetterTopic),
+	}
+}
+
+// функция для публикации сообщения в dead-letter топик
+// ключ, тело и заголовки исходного сообщения сохраняются, к ним добавляются заголовки с причиной ошибки
+// возвращаемое значение: ошибка, если сообщение не опубликовано
+func (p *DeadLetterPublisher) Publish(ctx context.Context, msg kafka.Message, stage string, reason error, attempts int) error {
+	headers := make([]kafka.Header, 0, len(msg.Headers)+7)
+	headers = append(headers, msg.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderReason, Value: []byte(reason.Error())},
+		kafka.Header{Key: HeaderStage, Value: []byte(stage)},
+		kafka.Header{Key: HeaderOriginalTopic, Value: []byte(msg.Topic)},
+		kafka.Header{Key: HeaderOriginalPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka.Header{Key: HeaderOriginalOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		kafka.Header{Key: HeaderAttempts, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: HeaderFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+	)
+
+	err := p.Writer.WriteMessages(ctx, kafka.Message{
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	})
+	if err != nil {
+		log.Printf("[KAFKA] Ошибка отправки сообщения %d из партиции %d в dead-letter топик: %v", msg.Offset, msg.Partition, err)
+		return err
+	}
+	log.Printf("[KAFKA] Сообщение %d из партиции %d отправлено в dead-letter топик (%s): %v", msg.Offset, msg.Partition, stage, reason)
+	return nil
+}
+
+// функция для закрытия писателя сообщений
+func (p *DeadLetterPublisher) Close() error {
+	return p.Writer.Close()
+}
@@ -0,0 +1,159 @@
+package kafka
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// результаты обработки сообщения для метрики processed_total
+const (
+	resultSaved   = "saved"   // заказ сохранен
+	resultSkipped = "skipped" // сообщение пропущено (отправлено в dead-letter топик)
+)
+
+// этап для ошибок, после которых сообщение обрабатывается повторно
+const stageRetry = "retry"
+
+// структура метрик консьюмера в формате Prometheus
+// отставание и статистика чтения берутся из Reader.Stats() при каждом опросе, обработка измеряется консьюмером
+type Metrics struct {
+	consumer *Consumer
+
+	processed *prometheus.CounterVec   // обработанные сообщения по партициям и результатам
+	errors    *prometheus.CounterVec   // ошибки обработки по партициям и этапам
+	latency   *prometheus.HistogramVec // время обработки сообщения (в пакетном режиме - пакета)
+
+	lagDesc        *prometheus.Desc
+	offsetDesc     *prometheus.Desc
+	fetchedDesc    *prometheus.Desc
+	bytesDesc      *prometheus.Desc
+	readErrorsDesc *prometheus.Desc
+	rateDesc       *prometheus.Desc
+
+	mu         sync.Mutex
+	partitions map[int]*partitionStats // накопленная статистика ридеров (Reader.Stats() сбрасывает счетчики)
+}
+
+// структура накопленной статистики ридера партиции
+type partitionStats struct {
+	messages  int64
+	bytes     int64
+	errors    int64
+	lag       int64
+	offset    int64
+	rate      float64   // сообщений в секунду с момента предыдущего опроса
+	collected time.Time // время предыдущего опроса
+}
+
+// функция для создания метрик консьюмера
+// метрики нужно зарегистрировать в реестре Prometheus (prometheus.Registerer.MustRegister)
+func NewMetrics(consumer *Consumer) *Metrics {
+	labels := []string{"topic", "partition"}
+	m := &Metrics{
+		consumer: consumer,
+		processed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "orders_consumer_processed_total",
+			Help: "Количество обработанных сообщений по результату обработки (saved, skipped).",
+		}, append(labels, "result")),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "orders_consumer_errors_total",
+			Help: "Количество ошибок обработки сообщений по этапам (decode, validate, save, retry).",
+		}, append(labels, "stage")),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "orders_consumer_processing_seconds",
+			Help:    "Время обработки сообщения (в пакетном режиме - пакета сообщений).",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 14), // от 1 мс до ~8 с
+		}, labels),
+		lagDesc:        prometheus.NewDesc("orders_consumer_lag", "Отставание консьюмера от конца партиции в сообщениях.", labels, nil),
+		offsetDesc:     prometheus.NewDesc("orders_consumer_offset", "Смещение следующего сообщения, которое прочитает ридер партиции.", labels, nil),
+		fetchedDesc:    prometheus.NewDesc("orders_consumer_fetched_messages_total", "Количество сообщений, прочитанных из партиции.", labels, nil),
+		bytesDesc:      prometheus.NewDesc("orders_consumer_fetched_bytes_total", "Объем сообщений, прочитанных из партиции, в байтах.", labels, nil),
+		readErrorsDesc: prometheus.NewDesc("orders_consumer_read_errors_total", "Количество ошибок чтения из партиции.", labels, nil),
+		rateDesc:       prometheus.NewDesc("orders_consumer_messages_per_second", "Скорость чтения сообщений из партиции с момента предыдущего опроса.", labels, nil),
+		partitions:     make(map[int]*partitionStats),
+	}
+	return m
+}
+
+// функция для описания метрик (реализация prometheus.Collector)
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.processed.Describe(ch)
+	m.errors.Describe(ch)
+	m.latency.Describe(ch)
+	ch <- m.lagDesc
+	ch <- m.offsetDesc
+	ch <- m.fetchedDesc
+	ch <- m.bytesDesc
+	ch <- m.readErrorsDesc
+	ch <- m.rateDesc
+}
+
+// функция для сбора метрик (реализация prometheus.Collector)
+// статистика ридеров запрашивается при каждом опросе и накапливается, так как Reader.Stats() возвращает значения с прошлого вызова
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.processed.Collect(ch)
+	m.errors.Collect(ch)
+	m.latency.Collect(ch)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, reader := range m.consumer.readers() {
+		stats := reader.Stats()
+		partition, err := strconv.Atoi(stats.Partition)
+		if err != nil {
+			continue
+		}
+
+		ps, ok := m.partitions[partition]
+		if !ok {
+			ps = &partitionStats{}
+			m.partitions[partition] = ps
+		}
+		ps.messages += stats.Messages
+		ps.bytes += stats.Bytes
+		ps.errors += stats.Errors
+		ps.lag = stats.Lag
+		ps.offset = stats.Offset
+		if !ps.collected.IsZero() {
+			ps.rate = float64(stats.Messages) / now.Sub(ps.collected).Seconds()
+		}
+		ps.collected = now
+
+		labels := []string{stats.Topic, stats.Partition}
+		ch <- prometheus.MustNewConstMetric(m.lagDesc, prometheus.GaugeValue, float64(ps.lag), labels...)
+		ch <- prometheus.MustNewConstMetric(m.offsetDesc, prometheus.GaugeValue, float64(ps.offset), labels...)
+		ch <- prometheus.MustNewConstMetric(m.fetchedDesc, prometheus.CounterValue, float64(ps.messages), labels...)
+		ch <- prometheus.MustNewConstMetric(m.bytesDesc, prometheus.CounterValue, float64(ps.bytes), labels...)
+		ch <- prometheus.MustNewConstMetric(m.readErrorsDesc, prometheus.CounterValue, float64(ps.errors), labels...)
+		ch <- prometheus.MustNewConstMetric(m.rateDesc, prometheus.GaugeValue, ps.rate, labels...)
+	}
+}
+
+// функция для учета времени обработки сообщения или пакета
+func (m *Metrics) observeLatency(topic string, partition int, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.latency.WithLabelValues(topic, strconv.Itoa(partition)).Observe(time.Since(start).Seconds())
+}
+
+// функция для учета обработанных сообщений
+func (m *Metrics) addProcessed(topic string, partition int, result string, count int) {
+	if m == nil || count == 0 {
+		return
+	}
+	m.processed.WithLabelValues(topic, strconv.Itoa(partition), result).Add(float64(count))
+}
+
+// функция для учета ошибки обработки на указанном этапе
+func (m *Metrics) addError(topic string, partition int, stage string) {
+	if m == nil {
+		return
+	}
+	m.errors.WithLabelValues(topic, strconv.Itoa(partition), stage).Inc()
+}
@@ -0,0 +1,114 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"wb-tech-test/internal/db"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	outboxBatchSize    = 100             // максимальное количество событий, отправляемых за одну итерацию
+	outboxPollInterval = 1 * time.Second // интервал опроса таблицы outbox
+)
+
+// структура для ретранслятора событий из таблицы outbox в Kafka
+type OutboxRelay struct {
+	Writer *kafka.Writer // писатель сообщений в Kafka
+	DB     *db.DB        // БД
+}
+
+// функция для создания нового ретранслятора событий в топик событий из настроек
+// события одного заказа попадают в одну партицию
+func NewOutboxRelay(cfg Config, db *db.DB) *OutboxRelay {
+	return &OutboxRelay{
+		Writer: cfg.NewWriter(cfg.EventsTopic),
+		DB:     db,
+	}
+}
+
+// функция для периодической отправки неотправленных событий из outbox в Kafka
+// работает до отмены контекста
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.relayPending(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Printf("[OUTBOX] Ретранслятор остановлен")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// функция для отправки одной пачки неотправленных событий
+// пачка отправляется одним вызовом WriteMessages; событие, которое не удалось отправить, откладывается,
+// а следующие события того же заказа не отправляются, пока оно не будет отправлено
+func (r *OutboxRelay) relayPending(ctx context.Context) {
+	sent, err := r.DB.RelayOutboxEvents(ctx, outboxBatchSize, r.send)
+	if err != nil {
+		log.Printf("[OUTBOX] Ошибка отправки событий: %v", err)
+		return
+	}
+	if sent > 0 {
+		log.Printf("[OUTBOX] Отправлено событий: %d", sent)
+	}
+}
+
+// функция для отправки пачки событий в Kafka
+// отправляется только первое событие каждого заказа, остальные события заказа пропускаются до следующей пачки
+// возвращаемое значение: ошибка отправки для каждого события (nil - событие отправлено)
+func (r *OutboxRelay) send(ctx context.Context, events []db.OutboxEvent) []error {
+	errs := make([]error, len(events))
+	seen := make(map[string]bool, len(events))
+	indexes := make([]int, 0, len(events)) // индексы отправляемых событий
+	messages := make([]kafka.Message, 0, len(events))
+	for i, event := range events {
+		if seen[event.OrderUID] {
+			errs[i] = db.ErrOutboxEventSkipped
+			continue
+		}
+		seen[event.OrderUID] = true
+		indexes = append(indexes, i)
+		messages = append(messages, kafka.Message{
+			Key:   []byte(event.OrderUID),
+			Value: event.Payload,
+			Headers: []kafka.Header{
+				{Key: "event_type", Value: []byte(event.EventType)},
+			},
+		})
+	}
+
+	err := r.Writer.WriteMessages(ctx, messages...)
+	if err == nil {
+		return errs
+	}
+
+	// WriteErrors содержит ошибку для каждого сообщения, иначе не отправлена вся пачка
+	var writeErrs kafka.WriteErrors
+	perMessage := errors.As(err, &writeErrs) && len(writeErrs) == len(messages)
+	for j, i := range indexes {
+		if perMessage {
+			errs[i] = writeErrs[j]
+		} else {
+			errs[i] = err
+		}
+		if errs[i] != nil {
+			log.Printf("[OUTBOX] Ошибка отправки события %d для заказа %s (попытка %d): %v", events[i].ID, events[i].OrderUID, events[i].Attempts+1, errs[i])
+		}
+	}
+	return errs
+}
+
+// функция для закрытия писателя сообщений
+func (r *OutboxRelay) Close() error {
+	return r.Writer.Close()
+}
@@ -0,0 +1,153 @@
+package kafka
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"sync"
+
+	"wb-tech-test/internal/db"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// размер очереди сообщений одного обработчика
+// ограничивает количество прочитанных, но еще не обработанных сообщений партиции
+const workerQueueSize = 64
+
+// функция для параллельного чтения сообщений из одной партиции
+// сообщения распределяются между обработчиками по ключу, поэтому сообщения одного заказа обрабатываются строго по порядку,
+// а смещение партиции сдвигается только до последнего сообщения, перед которым все сообщения уже обработаны
+func (c *Consumer) consumePartitionConcurrently(ctx context.Context, reader *kafka.Reader) {
+	tracker := &offsetTracker{store: c.DB}
+	queues := make([]chan kafka.Message, c.Workers)
+
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, workerQueueSize)
+		wg.Add(1)
+		go func(queue <-chan kafka.Message) {
+			defer wg.Done()
+			c.runWorker(ctx, queue, tracker)
+		}(queues[i])
+	}
+
+	for {
+		msg, ok := fetchMessage(ctx, reader)
+		if !ok {
+			break // консьюмер остановлен
+		}
+
+		tracker.add(msg.Offset)
+		select {
+		case queues[workerIndex(msg, len(queues))] <- msg:
+		case <-ctx.Done():
+		}
+	}
+
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+	tracker.flush(context.Background()) // сохраняем смещение, которое не удалось сохранить ранее
+}
+
+// функция обработчика сообщений из очереди
+// при временной ошибке сообщение обрабатывается повторно с экспоненциальной задержкой, остальные сообщения очереди ждут;
+// после остановки консьюмера оставшиеся в очереди сообщения не обрабатываются и будут прочитаны повторно при следующем запуске
+func (c *Consumer) runWorker(ctx context.Context, queue <-chan kafka.Message, tracker *offsetTracker) {
+	for msg := range queue {
+		if ctx.Err() != nil {
+			continue // дочитываем очередь, чтобы не блокировать чтение партиции
+		}
+
+		for attempt := 1; ; attempt++ {
+			// начатая обработка завершается даже после отмены контекста
+			err := c.handleMessage(context.WithoutCancel(ctx), msg, attempt)
+			if err == nil {
+				tracker.done(ctx, msg)
+				break
+			}
+			delay := retryBackoff(attempt)
+			log.Printf("[KAFKA] Повторная обработка сообщения %d из партиции %d через %s (попытка %d)", msg.Offset, msg.Partition, delay, attempt+1)
+			if !sleepContext(ctx, delay) {
+				break
+			}
+		}
+	}
+}
+
+// функция для выбора обработчика сообщения
+// возвращаемое значение: номер обработчика, одинаковый для всех сообщений с одним ключом
+func workerIndex(msg kafka.Message, workers int) int {
+	if len(msg.Key) == 0 {
+		return int(msg.Offset % int64(workers)) // сообщения без ключа распределяются по кругу
+	}
+	hash := fnv.New32a()
+	hash.Write(msg.Key)
+	return int(hash.Sum32() % uint32(workers))
+}
+
+// структура для отслеживания обработанных смещений партиции
+// сообщения обрабатываются не по порядку, поэтому сохраняется смещение последнего сообщения,
+// перед которым все прочитанные сообщения уже обработаны
+type offsetTracker struct {
+	mu        sync.Mutex
+	store     db.OrderStore
+	pending   []pendingOffset   // прочитанные сообщения в порядке смещений
+	completed *db.SourceMessage // последнее сообщение, до которого все обработано
+	committed int64             // последнее сохраненное в БД смещение
+}
+
+// структура для прочитанного сообщения, ожидающего обработки
+type pendingOffset struct {
+	offset int64
+	done   bool
+}
+
+// функция для регистрации прочитанного сообщения
+func (t *offsetTracker) add(offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = append(t.pending, pendingOffset{offset: offset})
+}
+
+// функция для отметки сообщения как обработанного
+// если перед сообщением не осталось необработанных, смещение партиции сохраняется в БД
+func (t *offsetTracker) done(ctx context.Context, msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := range t.pending {
+		if t.pending[i].offset == msg.Offset {
+			t.pending[i].done = true
+			break
+		}
+	}
+
+	// сдвигаем границу обработанных сообщений
+	for len(t.pending) > 0 && t.pending[0].done {
+		t.completed = &db.SourceMessage{Topic: msg.Topic, Partition: msg.Partition, Offset: t.pending[0].offset}
+		t.pending = t.pending[1:]
+	}
+	t.commit(ctx)
+}
+
+// функция для сохранения смещения, которое еще не удалось сохранить
+func (t *offsetTracker) flush(ctx context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.commit(ctx)
+}
+
+// функция для сохранения границы обработанных сообщений в БД
+// вызывается под блокировкой, поэтому смещения сохраняются строго по возрастанию
+func (t *offsetTracker) commit(ctx context.Context) {
+	if t.completed == nil || t.completed.Offset+1 == t.committed {
+		return
+	}
+	if err := t.store.SaveKafkaOffset(context.WithoutCancel(ctx), *t.completed); err != nil {
+		return // смещение будет сохранено при обработке следующего сообщения или при остановке
+	}
+	t.committed = t.completed.Offset + 1
+}
@@ -0,0 +1,83 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"wb-tech-test/internal/db"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// хранилище, запоминающее сохраненные смещения; остальные методы OrderStore в тестах не вызываются
+type offsetStore struct {
+	db.OrderStore
+	saved []int64 // сохраненные смещения по порядку
+	fail  bool    // вернуть ошибку при сохранении
+}
+
+func (s *offsetStore) SaveKafkaOffset(ctx context.Context, source db.SourceMessage) error {
+	if s.fail {
+		return errors.New("БД недоступна")
+	}
+	s.saved = append(s.saved, source.Offset)
+	return nil
+}
+
+func TestOffsetTrackerCommitsContiguousPrefix(t *testing.T) {
+	store := &offsetStore{}
+	tracker := &offsetTracker{store: store}
+	for offset := int64(10); offset < 15; offset++ {
+		tracker.add(offset)
+	}
+
+	msg := func(offset int64) kafka.Message {
+		return kafka.Message{Topic: "orders", Partition: 0, Offset: offset}
+	}
+
+	// сообщения завершаются не по порядку: граница сдвигается только через непрерывно обработанные смещения
+	steps := []struct {
+		done int64
+		want []int64 // сохраненные смещения после шага
+	}{
+		{12, nil},             // 10 и 11 еще обрабатываются
+		{11, nil},             // 10 еще обрабатывается
+		{10, []int64{12}},     // 10-12 обработаны
+		{14, []int64{12}},     // 13 еще обрабатывается
+		{13, []int64{12, 14}}, // все обработаны
+	}
+	for _, step := range steps {
+		tracker.done(context.Background(), msg(step.done))
+		if !slices.Equal(store.saved, step.want) {
+			t.Fatalf("после обработки %d сохранены смещения %v, ожидается %v", step.done, store.saved, step.want)
+		}
+	}
+}
+
+func TestOffsetTrackerRetriesFailedCommit(t *testing.T) {
+	store := &offsetStore{fail: true}
+	tracker := &offsetTracker{store: store}
+	tracker.add(0)
+	tracker.add(1)
+
+	tracker.done(context.Background(), kafka.Message{Offset: 0})
+	if len(store.saved) != 0 {
+		t.Fatalf("смещение сохранено при недоступной БД: %v", store.saved)
+	}
+
+	// смещение, не сохраненное из-за ошибки, сохраняется при остановке
+	store.fail = false
+	tracker.flush(context.Background())
+	if !slices.Equal(store.saved, []int64{0}) {
+		t.Fatalf("после flush сохранены смещения %v, ожидается [0]", store.saved)
+	}
+
+	// повторный flush без новых сообщений ничего не сохраняет
+	tracker.flush(context.Background())
+	tracker.done(context.Background(), kafka.Message{Offset: 1})
+	if !slices.Equal(store.saved, []int64{0, 1}) {
+		t.Fatalf("сохранены смещения %v, ожидается [0 1]", store.saved)
+	}
+}
@@ -0,0 +1,241 @@
+package kafka
+
+import (
+	"fmt"
+	"time"
+
+	"wb-tech-test/internal/model"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// декодер заказов в формате Protobuf (схема - schemas/order.proto)
+// сообщение разбирается по номерам полей без сгенерированного кода, неизвестные поля пропускаются
+type ProtobufDecoder struct{}
+
+// структура поля Protobuf-сообщения
+type protoField struct {
+	num    protowire.Number
+	typ    protowire.Type
+	varint uint64 // значение поля типа varint
+	bytes  []byte // значение поля типа length-delimited (строка или вложенное сообщение)
+}
+
+// функция для декодирования заказа из Protobuf
+// возвращаемое значение: заказ и ошибка, если сообщение некорректно
+func (ProtobufDecoder) Decode(value []byte) (model.Order, error) {
+	var order model.Order
+	err := walkProto(value, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			order.OrderUID, err = f.string()
+		case 2:
+			order.TrackNumber, err = f.string()
+		case 3:
+			order.Entry, err = f.string()
+		case 4:
+			err = f.message(func(b []byte) (err error) {
+				order.Delivery, err = decodeProtoDelivery(b)
+				return err
+			})
+		case 5:
+			err = f.message(func(b []byte) (err error) {
+				order.Payment, err = decodeProtoPayment(b)
+				return err
+			})
+		case 6:
+			err = f.message(func(b []byte) error {
+				item, err := decodeProtoItem(b)
+				order.Items = append(order.Items, item)
+				return err
+			})
+		case 7:
+			order.Locale, err = f.string()
+		case 8:
+			order.InternalSignature, err = f.string()
+		case 9:
+			order.CustomerID, err = f.string()
+		case 10:
+			order.DeliveryService, err = f.string()
+		case 11:
+			order.ShardKey, err = f.string()
+		case 12:
+			order.SmID, err = f.int()
+		case 13:
+			err = f.message(func(b []byte) (err error) {
+				order.DateCreated, err = decodeProtoTimestamp(b)
+				return err
+			})
+		case 14:
+			order.OofShard, err = f.string()
+		}
+		return err
+	})
+	return order, err
+}
+
+// функция для декодирования доставки из Protobuf
+// возвращаемое значение: доставка и ошибка, если сообщение некорректно
+func decodeProtoDelivery(b []byte) (model.Delivery, error) {
+	var delivery model.Delivery
+	err := walkProto(b, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			delivery.Name, err = f.string()
+		case 2:
+			delivery.Phone, err = f.string()
+		case 3:
+			delivery.Zip, err = f.string()
+		case 4:
+			delivery.City, err = f.string()
+		case 5:
+			delivery.Address, err = f.string()
+		case 6:
+			delivery.Region, err = f.string()
+		case 7:
+			delivery.Email, err = f.string()
+		}
+		return err
+	})
+	return delivery, err
+}
+
+// функция для декодирования оплаты из Protobuf
+// возвращаемое значение: оплата и ошибка, если сообщение некорректно
+func decodeProtoPayment(b []byte) (model.Payment, error) {
+	var payment model.Payment
+	err := walkProto(b, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			payment.Transaction, err = f.string()
+		case 2:
+			payment.RequestID, err = f.string()
+		case 3:
+			payment.Currency, err = f.string()
+		case 4:
+			payment.Provider, err = f.string()
+		case 5:
+			payment.Amount, err = f.int()
+		case 6:
+			payment.PaymentDT, err = f.int()
+		case 7:
+			payment.Bank, err = f.string()
+		case 8:
+			payment.DeliveryCost, err = f.int()
+		case 9:
+			payment.GoodsTotal, err = f.int()
+		case 10:
+			payment.CustomFee, err = f.int()
+		}
+		return err
+	})
+	return payment, err
+}
+
+// функция для декодирования товара из Protobuf
+// возвращаемое значение: товар и ошибка, если сообщение некорректно
+func decodeProtoItem(b []byte) (model.Item, error) {
+	var item model.Item
+	err := walkProto(b, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			item.ChrtID, err = f.int()
+		case 2:
+			item.TrackNumber, err = f.string()
+		case 3:
+			item.Price, err = f.int()
+		case 4:
+			item.Rid, err = f.string()
+		case 5:
+			item.Name, err = f.string()
+		case 6:
+			item.Sale, err = f.int()
+		case 7:
+			item.Size, err = f.string()
+		case 8:
+			item.TotalPrice, err = f.int()
+		case 9:
+			item.NmID, err = f.int()
+		case 10:
+			item.Brand, err = f.string()
+		case 11:
+			item.Status, err = f.int()
+		}
+		return err
+	})
+	return item, err
+}
+
+// функция для декодирования google.protobuf.Timestamp
+// возвращаемое значение: время в UTC и ошибка, если сообщение некорректно
+func decodeProtoTimestamp(b []byte) (time.Time, error) {
+	var seconds, nanos int
+	err := walkProto(b, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			seconds, err = f.int()
+		case 2:
+			nanos, err = f.int()
+		}
+		return err
+	})
+	return time.Unix(int64(seconds), int64(nanos)).UTC(), err
+}
+
+// функция для обхода полей Protobuf-сообщения
+// возвращаемое значение: ошибка разбора сообщения или ошибка обработчика поля
+func walkProto(b []byte, fn func(protoField) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		field := protoField{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			field.varint, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			field.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b) // поля других типов в схеме заказа не используются
+		}
+		if n < 0 {
+			return fmt.Errorf("поле %d: %w", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		if err := fn(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// функция для получения строкового значения поля
+// возвращаемое значение: строка и ошибка, если тип поля не совпадает со схемой
+func (f protoField) string() (string, error) {
+	if f.typ != protowire.BytesType {
+		return "", fmt.Errorf("поле %d: ожидается строка", f.num)
+	}
+	return string(f.bytes), nil
+}
+
+// функция для получения целочисленного значения поля (int32/int64)
+// возвращаемое значение: число и ошибка, если тип поля не совпадает со схемой
+func (f protoField) int() (int, error) {
+	if f.typ != protowire.VarintType {
+		return 0, fmt.Errorf("поле %d: ожидается число", f.num)
+	}
+	return int(int64(f.varint)), nil
+}
+
+// функция для декодирования вложенного сообщения
+// возвращаемое значение: ошибка, если тип поля не совпадает со схемой или сообщение некорректно
+func (f protoField) message(decode func([]byte) error) error {
+	if f.typ != protowire.BytesType {
+		return fmt.Errorf("поле %d: ожидается сообщение", f.num)
+	}
+	return decode(f.bytes)
+}
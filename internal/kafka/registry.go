@@ -0,0 +1,84 @@
+package kafka
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/hamba/avro/v2"
+)
+
+// субъект схемы заказа в реестре (по правилу именования Schema Registry: <топик>-value)
+const OrderSubject = "orders-value"
+
+// Avro-схема заказа, встроенная в бинарный файл
+//
+//go:embed schemas/order.avsc
+var OrderAvroSchema string
+
+// ошибка, возвращаемая для незарегистрированного идентификатора схемы
+var ErrSchemaNotFound = errors.New("схема не найдена в реестре")
+
+// структура локального реестра Avro-схем
+// совместима с Schema Registry по идентификаторам: одинаковая схема получает один и тот же идентификатор,
+// поэтому продюсеры могут использовать идентификаторы, выданные реестром при старте сервиса
+type SchemaRegistry struct {
+	mu       sync.RWMutex
+	schemas  map[int]avro.Schema // схемы по идентификаторам
+	ids      map[[32]byte]int    // идентификаторы по отпечаткам схем
+	subjects map[string][]int    // версии схем по субъектам
+}
+
+// функция для создания пустого реестра схем
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{
+		schemas:  make(map[int]avro.Schema),
+		ids:      make(map[[32]byte]int),
+		subjects: make(map[string][]int),
+	}
+}
+
+// функция для регистрации схемы в субъекте
+// повторная регистрация той же схемы возвращает уже выданный идентификатор
+// возвращаемое значение: идентификатор схемы и ошибка, если схема некорректна
+func (r *SchemaRegistry) Register(subject, definition string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// каждая схема разбирается со своим кешем типов, чтобы версии с одинаковыми именами записей не конфликтовали
+	schema, err := avro.ParseWithCache(definition, "", &avro.SchemaCache{})
+	if err != nil {
+		return 0, fmt.Errorf("схема субъекта %s: %w", subject, err)
+	}
+	fingerprint := schema.Fingerprint()
+
+	id, ok := r.ids[fingerprint]
+	if !ok {
+		id = len(r.schemas) + 1 // идентификаторы выдаются по порядку, начиная с 1
+		r.schemas[id] = schema
+		r.ids[fingerprint] = id
+	}
+	for _, version := range r.subjects[subject] {
+		if version == id {
+			return id, nil
+		}
+	}
+	r.subjects[subject] = append(r.subjects[subject], id)
+	log.Printf("[KAFKA] Схема %d зарегистрирована в субъекте %s (версия %d)", id, subject, len(r.subjects[subject]))
+	return id, nil
+}
+
+// функция для получения схемы по идентификатору
+// возвращаемое значение: схема и ErrSchemaNotFound, если схема не зарегистрирована
+func (r *SchemaRegistry) Schema(id int) (avro.Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schema, ok := r.schemas[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrSchemaNotFound, id)
+	}
+	return schema, nil
+}
@@ -0,0 +1,64 @@
+package kafka
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	retryBaseDelay = 500 * time.Millisecond // задержка перед первой повторной попыткой
+	retryMaxDelay  = 30 * time.Second       // максимальная задержка между попытками
+)
+
+// функция для расчета задержки перед повторной попыткой
+// задержка растет экспоненциально и содержит случайную составляющую (jitter),
+// чтобы консьюмеры не обращались к восстановившейся БД одновременно
+// возвращаемое значение: задержка от половины до полного значения экспоненциальной задержки
+func retryBackoff(attempt int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempt && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, retryMaxDelay)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// функция для ожидания перед повторной попыткой
+// возвращаемое значение: false, если ожидание прервано отменой контекста
+func sleepContext(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// функция для чтения следующего сообщения партиции без автоматического коммита
+// при ошибке чтения (например, пока брокер недоступен) чтение повторяется с той же экспоненциальной задержкой,
+// что и обработка сообщений, чтобы не нагружать брокер и не засорять лог
+// возвращаемое значение: сообщение и false, если консьюмер остановлен
+func fetchMessage(ctx context.Context, reader *kafka.Reader) (kafka.Message, bool) {
+	for attempt := 1; ; attempt++ {
+		msg, err := reader.FetchMessage(ctx)
+		if ctx.Err() != nil {
+			return msg, false
+		}
+		if err == nil {
+			return msg, true
+		}
+
+		delay := retryBackoff(attempt)
+		log.Printf("[KAFKA] Ошибка чтения сообщения из партиции %d: %v, повтор через %s (попытка %d)", reader.Config().Partition, err, delay, attempt+1)
+		if !sleepContext(ctx, delay) {
+			return msg, false
+		}
+	}
+}
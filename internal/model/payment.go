@@ -0,0 +1,48 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// функция для получения времени оплаты
+// возвращаемое значение: время оплаты в UTC, полученное из unix-времени PaymentDT
+func (p Payment) PaymentTime() time.Time {
+	return time.Unix(int64(p.PaymentDT), 0).UTC()
+}
+
+// структура для JSON-представления оплаты
+// помимо unix-времени payment_dt содержит время оплаты в формате RFC3339
+type paymentJSON struct {
+	paymentFields
+	PaymentTime *time.Time `json:"payment_time,omitempty"`
+}
+
+// тип с полями Payment без собственных методов сериализации (для избежания рекурсии)
+type paymentFields Payment
+
+// функция для сериализации оплаты в JSON
+// возвращаемое значение: JSON с полями payment_dt и payment_time (payment_time опускается, если время оплаты не задано)
+func (p Payment) MarshalJSON() ([]byte, error) {
+	encoded := paymentJSON{paymentFields: paymentFields(p)}
+	if p.PaymentDT != 0 {
+		paymentTime := p.PaymentTime()
+		encoded.PaymentTime = &paymentTime
+	}
+	return json.Marshal(encoded)
+}
+
+// функция для десериализации оплаты из JSON
+// если payment_dt не задан, он вычисляется из payment_time
+// возвращаемое значение: ошибка, если JSON некорректен
+func (p *Payment) UnmarshalJSON(data []byte) error {
+	var decoded paymentJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*p = Payment(decoded.paymentFields)
+	if p.PaymentDT == 0 && decoded.PaymentTime != nil {
+		p.PaymentDT = int(decoded.PaymentTime.Unix())
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// структура для исходного сообщения Kafka, из которого был сохранен заказ
+type RawMessage struct {
+	OrderUID    string          `json:"order_uid"`
+	Topic       string          `json:"topic"`
+	Partition   int             `json:"partition"`
+	Offset      int64           `json:"offset"`
+	Key         string          `json:"key"`
+	MessageTime time.Time       `json:"message_time"` // время сообщения в Kafka
+	ReceivedAt  time.Time       `json:"received_at"`  // время сохранения сообщения в БД
+	Payload     json.RawMessage `json:"payload"`      // тело сообщения в исходном виде (для двоичных форматов - декодированный заказ)
+
+	ContentType   string `json:"content_type"`             // формат тела сообщения
+	PayloadBinary []byte `json:"payload_binary,omitempty"` // исходное тело сообщения в двоичном формате (Protobuf, Avro)
+}
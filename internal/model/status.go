@@ -0,0 +1,58 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// статус заказа
+type OrderStatus string
+
+const (
+	StatusCreated   OrderStatus = "created"   // заказ создан
+	StatusPaid      OrderStatus = "paid"      // заказ оплачен
+	StatusShipped   OrderStatus = "shipped"   // заказ передан в доставку
+	StatusDelivered OrderStatus = "delivered" // заказ доставлен
+	StatusCancelled OrderStatus = "cancelled" // заказ отменен
+	StatusReturned  OrderStatus = "returned"  // заказ возвращен
+)
+
+// ошибка, возвращаемая при недопустимой смене статуса заказа
+var ErrInvalidStatusTransition = errors.New("недопустимая смена статуса заказа")
+
+// допустимые переходы между статусами: ключ - текущий статус, значение - статусы, в которые можно перейти
+var statusTransitions = map[OrderStatus][]OrderStatus{
+	StatusCreated:   {StatusPaid, StatusCancelled},
+	StatusPaid:      {StatusShipped, StatusCancelled},
+	StatusShipped:   {StatusDelivered, StatusReturned},
+	StatusDelivered: {StatusReturned},
+	StatusCancelled: {},
+	StatusReturned:  {},
+}
+
+// структура для записи в истории статусов заказа
+type StatusChange struct {
+	OrderUID  string      `json:"order_uid"`
+	From      OrderStatus `json:"from,omitempty"` // пустой для первой записи при создании заказа
+	To        OrderStatus `json:"to"`
+	Comment   string      `json:"comment,omitempty"`
+	ChangedAt time.Time   `json:"changed_at"`
+}
+
+// функция для проверки, что статус известен
+// возвращаемое значение: true, если статус входит в жизненный цикл заказа
+func (s OrderStatus) IsValid() bool {
+	_, ok := statusTransitions[s]
+	return ok
+}
+
+// функция для проверки допустимости перехода из текущего статуса в новый
+// возвращаемое значение: true, если переход разрешен
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range statusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package model
+
+import "testing"
+
+func TestOrderStatusTransitions(t *testing.T) {
+	tests := []struct {
+		from, to OrderStatus
+		allowed  bool
+	}{
+		{StatusCreated, StatusPaid, true},
+		{StatusCreated, StatusCancelled, true},
+		{StatusPaid, StatusShipped, true},
+		{StatusPaid, StatusCancelled, true},
+		{StatusShipped, StatusDelivered, true},
+		{StatusShipped, StatusReturned, true},
+		{StatusDelivered, StatusReturned, true},
+
+		{StatusCreated, StatusShipped, false},   // нельзя отправить неоплаченный заказ
+		{StatusCreated, StatusDelivered, false}, // нельзя пропустить этапы
+		{StatusCreated, StatusCreated, false},   // повтор текущего статуса не является переходом
+		{StatusPaid, StatusCreated, false},      // назад по жизненному циклу не переходим
+		{StatusShipped, StatusCancelled, false}, // отправленный заказ можно только вернуть
+		{StatusDelivered, StatusCancelled, false},
+		{StatusCancelled, StatusPaid, false}, // отмененный и возвращенный заказы - конечные статусы
+		{StatusReturned, StatusShipped, false},
+		{StatusCreated, "unknown", false},
+		{"unknown", StatusPaid, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.from.CanTransitionTo(tt.to); got != tt.allowed {
+			t.Errorf("%q -> %q: CanTransitionTo = %v, ожидается %v", tt.from, tt.to, got, tt.allowed)
+		}
+	}
+}
+
+func TestOrderStatusIsValid(t *testing.T) {
+	for _, status := range []OrderStatus{StatusCreated, StatusPaid, StatusShipped, StatusDelivered, StatusCancelled, StatusReturned} {
+		if !status.IsValid() {
+			t.Errorf("статус %q должен быть допустимым", status)
+		}
+	}
+	for _, status := range []OrderStatus{"", "unknown", "Paid"} {
+		if status.IsValid() {
+			t.Errorf("статус %q не должен быть допустимым", status)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package validation
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// версия схемы заказа, используемая, если версия не указана в сообщении
+const CurrentOrderSchemaVersion = "v1"
+
+// схемы заказа по версиям, встроенные в бинарный файл
+//
+//go:embed schemas/order/*.json
+var orderSchemas embed.FS
+
+// ошибка, возвращаемая для неизвестной версии схемы
+var ErrUnknownSchemaVersion = errors.New("неизвестная версия схемы заказа")
+
+// ошибка, возвращаемая для сообщения, которое не является корректным JSON
+var ErrMalformedJSON = errors.New("некорректный JSON заказа")
+
+// для текстов ошибок проверок (на английском, как в библиотеке по умолчанию)
+var messagePrinter = message.NewPrinter(language.English)
+
+// для экранирования "~" и "/" в именах полей по правилам JSON Pointer
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// структура ошибки в конкретном поле сообщения
+type FieldError struct {
+	Field   string `json:"field"`   // путь к полю в формате JSON Pointer (например, /payment/amount)
+	Message string `json:"message"` // описание ошибки
+}
+
+// структура ошибки валидации со списком ошибок по полям
+type ValidationError struct {
+	Version string       `json:"schema_version"`
+	Errors  []FieldError `json:"errors"`
+}
+
+// функция для получения текста ошибки валидации
+// возвращаемое значение: все ошибки по полям через точку с запятой
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Errors))
+	for _, fieldErr := range e.Errors {
+		parts = append(parts, fieldErr.Field+": "+fieldErr.Message)
+	}
+	return fmt.Sprintf("заказ не соответствует схеме %s: %s", e.Version, strings.Join(parts, "; "))
+}
+
+// структура валидатора заказов
+// схемы всех версий компилируются один раз при создании валидатора
+type OrderValidator struct {
+	schemas map[string]*jsonschema.Schema // скомпилированные схемы по версиям
+}
+
+// функция для создания валидатора заказов по встроенным схемам
+// возвращаемое значение: указатель на валидатор и ошибка, если схемы не скомпилированы
+func NewOrderValidator() (*OrderValidator, error) {
+	files, err := orderSchemas.ReadDir("schemas/order")
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat() // форматы (date-time, email) проверяются, а не только описываются
+
+	validator := &OrderValidator{schemas: make(map[string]*jsonschema.Schema)}
+	for _, file := range files {
+		version := strings.TrimSuffix(file.Name(), ".json")
+		data, err := orderSchemas.ReadFile("schemas/order/" + file.Name())
+		if err != nil {
+			return nil, err
+		}
+		doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("схема заказа %s: %w", version, err)
+		}
+
+		url := "schemas/order/" + file.Name()
+		if err := compiler.AddResource(url, doc); err != nil {
+			return nil, fmt.Errorf("схема заказа %s: %w", version, err)
+		}
+		schema, err := compiler.Compile(url)
+		if err != nil {
+			return nil, fmt.Errorf("схема заказа %s: %w", version, err)
+		}
+		validator.schemas[version] = schema
+	}
+
+	if _, ok := validator.schemas[CurrentOrderSchemaVersion]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSchemaVersion, CurrentOrderSchemaVersion)
+	}
+	return validator, nil
+}
+
+// функция для проверки заказа в формате JSON по текущей версии схемы
+// возвращаемое значение: *ValidationError со списком ошибок по полям или ErrMalformedJSON
+func (v *OrderValidator) Validate(data []byte) error {
+	return v.ValidateVersion(CurrentOrderSchemaVersion, data)
+}
+
+// функция для проверки заказа в формате JSON по указанной версии схемы
+// пустая версия означает текущую версию
+// возвращаемое значение: *ValidationError со списком ошибок по полям, ErrUnknownSchemaVersion или ErrMalformedJSON
+func (v *OrderValidator) ValidateVersion(version string, data []byte) error {
+	if version == "" {
+		version = CurrentOrderSchemaVersion
+	}
+	schema, ok := v.schemas[version]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownSchemaVersion, version)
+	}
+
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedJSON, err)
+	}
+
+	err = schema.Validate(instance)
+	var schemaErr *jsonschema.ValidationError
+	if !errors.As(err, &schemaErr) {
+		return err
+	}
+	return &ValidationError{Version: version, Errors: fieldErrors(schemaErr)}
+}
+
+// функция для получения списка ошибок по полям из ошибки библиотеки
+// дерево ошибок обходится до конечных проверок: BasicOutput теряет ошибки, вложенные в $ref
+// (например, в delivery или payment), оставляя вместо них только обобщающую ошибку ссылки
+// возвращаемое значение: ошибки конечных проверок, отсортированные по пути к полю
+func fieldErrors(err *jsonschema.ValidationError) []FieldError {
+	var result []FieldError
+	var walk func(err *jsonschema.ValidationError)
+	walk = func(err *jsonschema.ValidationError) {
+		if len(err.Causes) > 0 {
+			for _, cause := range err.Causes {
+				walk(cause)
+			}
+			return
+		}
+		result = append(result, FieldError{Field: fieldPointer(err.InstanceLocation), Message: err.ErrorKind.LocalizedString(messagePrinter)})
+	}
+	walk(err)
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Field < result[j].Field
+	})
+	return result
+}
+
+// функция для получения пути к полю в формате JSON Pointer
+// возвращаемое значение: путь к полю ("/" для корня заказа)
+func fieldPointer(location []string) string {
+	if len(location) == 0 {
+		return "/"
+	}
+	var sb strings.Builder
+	for _, token := range location {
+		sb.WriteByte('/')
+		sb.WriteString(pointerEscaper.Replace(token))
+	}
+	return sb.String()
+}
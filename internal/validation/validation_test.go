@@ -0,0 +1,136 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// корректный заказ в формате JSON
+const validOrder = `{
+	"order_uid": "b563feb7b2b84b6test",
+	"track_number": "WBILMTESTTRACK",
+	"entry": "WBIL",
+	"delivery": {
+		"name": "Test Testov", "phone": "+9720000000", "zip": "2639809", "city": "Kiryat Mozkin",
+		"address": "Ploshad Mira 15", "region": "Kraiot", "email": "test@gmail.com"
+	},
+	"payment": {
+		"transaction": "b563feb7b2b84b6test", "request_id": "", "currency": "USD", "provider": "wbpay", "amount": 1817,
+		"payment_dt": 1637907727, "bank": "alpha", "delivery_cost": 1500, "goods_total": 317, "custom_fee": 0
+	},
+	"items": [{
+		"chrt_id": 9934930, "track_number": "WBILMTESTTRACK", "price": 453, "rid": "ab4219087a764ae0btest", "name": "Mascaras",
+		"sale": 30, "size": "0", "total_price": 317, "nm_id": 2389212, "brand": "Vivienne Sabo", "status": 202
+	}],
+	"locale": "en",
+	"internal_signature": "",
+	"customer_id": "test",
+	"delivery_service": "meest",
+	"shardkey": "9",
+	"sm_id": 99,
+	"date_created": "2021-11-26T06:22:19Z",
+	"oof_shard": "1"
+}`
+
+// функция для изменения корректного заказа
+// возвращаемое значение: заказ в формате JSON после изменения
+func modifiedOrder(t *testing.T, modify func(order map[string]any)) []byte {
+	t.Helper()
+	var order map[string]any
+	if err := json.Unmarshal([]byte(validOrder), &order); err != nil {
+		t.Fatalf("разбор корректного заказа: %v", err)
+	}
+	modify(order)
+	data, err := json.Marshal(order)
+	if err != nil {
+		t.Fatalf("кодирование заказа: %v", err)
+	}
+	return data
+}
+
+func TestOrderValidator(t *testing.T) {
+	validator, err := NewOrderValidator()
+	if err != nil {
+		t.Fatalf("NewOrderValidator: %v", err)
+	}
+	if err := validator.Validate([]byte(validOrder)); err != nil {
+		t.Fatalf("корректный заказ отклонен: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(order map[string]any)
+		fields []string // поля, для которых ожидаются ошибки
+	}{
+		{"нет order_uid", func(o map[string]any) { delete(o, "order_uid") }, []string{"/"}},
+		{"пустой список товаров", func(o map[string]any) { o["items"] = []any{} }, []string{"/items"}},
+		{"неизвестное поле", func(o map[string]any) { o["comment"] = "x" }, []string{"/"}},
+		{"некорректная дата", func(o map[string]any) { o["date_created"] = "26.11.2021" }, []string{"/date_created"}},
+		{"некорректный телефон", func(o map[string]any) { o["delivery"].(map[string]any)["phone"] = "phone" }, []string{"/delivery/phone"}},
+		{"валюта в нижнем регистре", func(o map[string]any) { o["payment"].(map[string]any)["currency"] = "usd" }, []string{"/payment/currency"}},
+		{"отрицательная сумма", func(o map[string]any) { o["payment"].(map[string]any)["amount"] = -1 }, []string{"/payment/amount"}},
+		{"скидка больше 100", func(o map[string]any) { o["items"].([]any)[0].(map[string]any)["sale"] = 101 }, []string{"/items/0/sale"}},
+		{"нет времени оплаты", func(o map[string]any) { delete(o["payment"].(map[string]any), "payment_dt") }, []string{"/payment"}},
+		{"некорректное payment_time", func(o map[string]any) {
+			payment := o["payment"].(map[string]any)
+			delete(payment, "payment_dt")
+			payment["payment_time"] = "26.11.2021"
+		}, []string{"/payment/payment_time"}},
+		{"несколько ошибок", func(o map[string]any) {
+			o["date_created"] = "вчера"
+			o["sm_id"] = -1
+		}, []string{"/date_created", "/sm_id"}},
+	}
+
+	paymentTime := modifiedOrder(t, func(o map[string]any) {
+		payment := o["payment"].(map[string]any)
+		delete(payment, "payment_dt")
+		payment["payment_time"] = "2021-11-26T06:22:07Z"
+	})
+	if err := validator.Validate(paymentTime); err != nil {
+		t.Errorf("заказ с payment_time вместо payment_dt отклонен: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validator.Validate(modifiedOrder(t, tt.modify))
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("ошибка %v, ожидается *ValidationError", err)
+			}
+			if validationErr.Version != CurrentOrderSchemaVersion {
+				t.Errorf("версия схемы %q, ожидается %q", validationErr.Version, CurrentOrderSchemaVersion)
+			}
+
+			var fields []string
+			for _, fieldErr := range validationErr.Errors {
+				if !slices.Contains(fields, fieldErr.Field) {
+					fields = append(fields, fieldErr.Field)
+				}
+			}
+			if !slices.Equal(fields, tt.fields) {
+				t.Errorf("ошибки в полях %v, ожидаются %v: %v", fields, tt.fields, err)
+			}
+		})
+	}
+}
+
+func TestOrderValidatorRejectsUnknownVersionAndMalformedJSON(t *testing.T) {
+	validator, err := NewOrderValidator()
+	if err != nil {
+		t.Fatalf("NewOrderValidator: %v", err)
+	}
+
+	if err := validator.ValidateVersion("v0", []byte(validOrder)); !errors.Is(err, ErrUnknownSchemaVersion) {
+		t.Errorf("неизвестная версия: ошибка %v, ожидается ErrUnknownSchemaVersion", err)
+	}
+	if err := validator.ValidateVersion("", []byte(validOrder)); err != nil {
+		t.Errorf("пустая версия должна означать текущую: %v", err)
+	}
+
+	if err := validator.Validate([]byte(`{"order_uid":`)); !errors.Is(err, ErrMalformedJSON) {
+		t.Errorf("некорректный JSON: ошибка %v, ожидается ErrMalformedJSON", err)
+	}
+}
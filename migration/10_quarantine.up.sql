@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS quarantine (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid VARCHAR NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    reason VARCHAR NOT NULL,
+    source_table VARCHAR NOT NULL,
+    row_data JSONB NOT NULL,
+    quarantined_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS quarantine_order_uid_idx ON quarantine (order_uid);
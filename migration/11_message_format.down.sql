@@ -0,0 +1,2 @@
+ALTER TABLE raw_messages DROP COLUMN IF EXISTS payload_binary;
+ALTER TABLE raw_messages DROP COLUMN IF EXISTS content_type;
@@ -0,0 +1,4 @@
+-- формат исходного сообщения Kafka: для двоичных форматов (Protobuf, Avro) тело сохраняется как есть,
+-- а в payload записывается декодированный заказ в JSON
+ALTER TABLE raw_messages ADD COLUMN IF NOT EXISTS content_type VARCHAR NOT NULL DEFAULT 'application/json';
+ALTER TABLE raw_messages ADD COLUMN IF NOT EXISTS payload_binary BYTEA;
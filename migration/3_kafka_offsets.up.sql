@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS kafka_offsets (
+    topic VARCHAR NOT NULL,
+    partition INTEGER NOT NULL,
+    next_offset BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (topic, partition)
+);
@@ -0,0 +1,82 @@
+ALTER TABLE items RENAME TO items_partitioned;
+ALTER TABLE delivery RENAME TO delivery_partitioned;
+ALTER TABLE payment RENAME TO payment_partitioned;
+ALTER TABLE orders RENAME TO orders_partitioned;
+
+CREATE TABLE orders (
+    order_uid VARCHAR PRIMARY KEY,
+    track_number VARCHAR,
+    entry VARCHAR,
+    locale VARCHAR,
+    internal_signature VARCHAR,
+    customer_id VARCHAR,
+    delivery_service VARCHAR,
+    shardkey VARCHAR,
+    sm_id INTEGER,
+    date_created TIMESTAMP,
+    oof_shard VARCHAR
+);
+
+CREATE TABLE delivery (
+    order_uid VARCHAR PRIMARY KEY REFERENCES orders(order_uid),
+    name VARCHAR,
+    phone VARCHAR,
+    zip VARCHAR,
+    city VARCHAR,
+    address VARCHAR,
+    region VARCHAR,
+    email VARCHAR
+);
+
+CREATE TABLE payment (
+    transaction VARCHAR PRIMARY KEY,
+    order_uid VARCHAR REFERENCES orders(order_uid),
+    request_id VARCHAR,
+    currency VARCHAR,
+    provider VARCHAR,
+    amount INTEGER,
+    payment_dt BIGINT,
+    bank VARCHAR,
+    delivery_cost INTEGER,
+    goods_total INTEGER,
+    custom_fee INTEGER
+);
+
+CREATE TABLE items (
+    id SERIAL PRIMARY KEY,
+    order_uid VARCHAR REFERENCES orders(order_uid),
+    chrt_id INTEGER,
+    track_number VARCHAR,
+    price INTEGER,
+    rid VARCHAR,
+    name VARCHAR,
+    sale INTEGER,
+    size VARCHAR,
+    total_price INTEGER,
+    nm_id INTEGER,
+    brand VARCHAR,
+    status INTEGER
+);
+
+INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard)
+SELECT order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
+FROM orders_partitioned;
+
+INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email)
+SELECT order_uid, name, phone, zip, city, address, region, email
+FROM delivery_partitioned;
+
+INSERT INTO payment (transaction, order_uid, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
+SELECT transaction, order_uid, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
+FROM payment_partitioned;
+
+INSERT INTO items (id, order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status)
+SELECT id, order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
+FROM items_partitioned;
+
+SELECT setval(pg_get_serial_sequence('items', 'id'), COALESCE((SELECT MAX(id) FROM items), 0) + 1, false);
+
+DROP TABLE items_partitioned;
+DROP TABLE delivery_partitioned;
+DROP TABLE payment_partitioned;
+DROP TABLE orders_partitioned;
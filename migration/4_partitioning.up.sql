@@ -0,0 +1,123 @@
+ALTER TABLE items RENAME TO items_old;
+ALTER TABLE delivery RENAME TO delivery_old;
+ALTER TABLE payment RENAME TO payment_old;
+ALTER TABLE orders RENAME TO orders_old;
+
+CREATE TABLE orders (
+    order_uid VARCHAR NOT NULL,
+    track_number VARCHAR,
+    entry VARCHAR,
+    locale VARCHAR,
+    internal_signature VARCHAR,
+    customer_id VARCHAR,
+    delivery_service VARCHAR,
+    shardkey VARCHAR,
+    sm_id INTEGER,
+    date_created TIMESTAMP NOT NULL,
+    oof_shard VARCHAR,
+    PRIMARY KEY (order_uid, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE TABLE delivery (
+    order_uid VARCHAR NOT NULL,
+    date_created TIMESTAMP NOT NULL,
+    name VARCHAR,
+    phone VARCHAR,
+    zip VARCHAR,
+    city VARCHAR,
+    address VARCHAR,
+    region VARCHAR,
+    email VARCHAR,
+    PRIMARY KEY (order_uid, date_created),
+    FOREIGN KEY (order_uid, date_created) REFERENCES orders (order_uid, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE TABLE payment (
+    transaction VARCHAR NOT NULL,
+    order_uid VARCHAR NOT NULL,
+    date_created TIMESTAMP NOT NULL,
+    request_id VARCHAR,
+    currency VARCHAR,
+    provider VARCHAR,
+    amount INTEGER,
+    payment_dt BIGINT,
+    bank VARCHAR,
+    delivery_cost INTEGER,
+    goods_total INTEGER,
+    custom_fee INTEGER,
+    PRIMARY KEY (transaction, date_created),
+    FOREIGN KEY (order_uid, date_created) REFERENCES orders (order_uid, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE TABLE items (
+    id SERIAL,
+    order_uid VARCHAR NOT NULL,
+    date_created TIMESTAMP NOT NULL,
+    chrt_id INTEGER,
+    track_number VARCHAR,
+    price INTEGER,
+    rid VARCHAR,
+    name VARCHAR,
+    sale INTEGER,
+    size VARCHAR,
+    total_price INTEGER,
+    nm_id INTEGER,
+    brand VARCHAR,
+    status INTEGER,
+    PRIMARY KEY (id, date_created),
+    FOREIGN KEY (order_uid, date_created) REFERENCES orders (order_uid, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE INDEX payment_order_uid_idx ON payment (order_uid, date_created);
+CREATE INDEX items_order_uid_idx ON items (order_uid, date_created);
+
+-- партиции по умолчанию для строк, для которых еще не создана месячная партиция
+-- месячные партиции создаются из Go (db.EnsurePartitions)
+CREATE TABLE orders_default PARTITION OF orders DEFAULT;
+CREATE TABLE delivery_default PARTITION OF delivery DEFAULT;
+CREATE TABLE payment_default PARTITION OF payment DEFAULT;
+CREATE TABLE items_default PARTITION OF items DEFAULT;
+
+-- месячные партиции для всех месяцев, по которым уже есть заказы, чтобы существующие строки не попали в партиции
+-- по умолчанию (иначе создание месячной партиции для этих месяцев будет отклонено)
+-- имена партиций совпадают с создаваемыми из Go (db.EnsurePartitions)
+DO $$
+DECLARE
+    month DATE;
+    tbl TEXT;
+BEGIN
+    FOR month IN
+        SELECT DISTINCT date_trunc('month', COALESCE(date_created, 'epoch'))::date FROM orders_old
+    LOOP
+        FOREACH tbl IN ARRAY ARRAY['orders', 'delivery', 'payment', 'items'] LOOP
+            EXECUTE format('CREATE TABLE %I PARTITION OF %I FOR VALUES FROM (%L) TO (%L)',
+                format('%s_y%sm%s', tbl, to_char(month, 'YYYY'), to_char(month, 'MM')),
+                tbl,
+                month::text || ' 00:00:00',
+                (month + interval '1 month')::date::text || ' 00:00:00');
+        END LOOP;
+    END LOOP;
+END $$;
+
+INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard)
+SELECT order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, COALESCE(date_created, 'epoch'), oof_shard
+FROM orders_old;
+
+INSERT INTO delivery (order_uid, date_created, name, phone, zip, city, address, region, email)
+SELECT d.order_uid, COALESCE(o.date_created, 'epoch'), d.name, d.phone, d.zip, d.city, d.address, d.region, d.email
+FROM delivery_old d JOIN orders_old o ON o.order_uid = d.order_uid;
+
+INSERT INTO payment (transaction, order_uid, date_created, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
+SELECT p.transaction, p.order_uid, COALESCE(o.date_created, 'epoch'), p.request_id, p.currency, p.provider, p.amount, p.payment_dt, p.bank, p.delivery_cost, p.goods_total, p.custom_fee
+FROM payment_old p JOIN orders_old o ON o.order_uid = p.order_uid;
+
+INSERT INTO items (id, order_uid, date_created, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status)
+SELECT i.id, i.order_uid, COALESCE(o.date_created, 'epoch'), i.chrt_id, i.track_number, i.price, i.rid, i.name, i.sale, i.size, i.total_price, i.nm_id, i.brand, i.status
+FROM items_old i JOIN orders_old o ON o.order_uid = i.order_uid;
+
+SELECT setval(pg_get_serial_sequence('items', 'id'), COALESCE((SELECT MAX(id) FROM items), 0) + 1, false);
+
+DROP TABLE items_old;
+DROP TABLE delivery_old;
+DROP TABLE payment_old;
+DROP TABLE orders_old;
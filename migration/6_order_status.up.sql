@@ -0,0 +1,15 @@
+ALTER TABLE orders ADD COLUMN status VARCHAR NOT NULL DEFAULT 'created';
+
+CREATE TABLE IF NOT EXISTS status_history (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid VARCHAR NOT NULL,
+    from_status VARCHAR,
+    to_status VARCHAR NOT NULL,
+    comment TEXT,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS status_history_order_uid_idx ON status_history (order_uid, id);
+
+INSERT INTO status_history (order_uid, from_status, to_status)
+SELECT order_uid, NULL, 'created' FROM orders;
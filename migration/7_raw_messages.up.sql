@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS raw_messages (
+    order_uid VARCHAR PRIMARY KEY,
+    topic VARCHAR NOT NULL,
+    partition INTEGER NOT NULL,
+    "offset" BIGINT NOT NULL,
+    key BYTEA,
+    payload JSONB NOT NULL,
+    message_time TIMESTAMPTZ,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
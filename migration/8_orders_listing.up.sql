@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS orders_date_created_uid_idx ON orders (date_created DESC, order_uid DESC);
+CREATE INDEX IF NOT EXISTS orders_customer_id_idx ON orders (customer_id, date_created DESC);
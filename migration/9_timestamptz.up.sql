@@ -0,0 +1,139 @@
+-- date_created является ключом секционирования, поэтому его тип нельзя изменить через ALTER COLUMN:
+-- таблицы пересоздаются, а данные переносятся через временные таблицы.
+-- Существующие значения TIMESTAMP хранят время без смещения и интерпретируются как UTC.
+
+CREATE TEMP TABLE orders_backup AS SELECT * FROM orders;
+CREATE TEMP TABLE delivery_backup AS SELECT * FROM delivery;
+CREATE TEMP TABLE payment_backup AS SELECT * FROM payment;
+CREATE TEMP TABLE items_backup AS SELECT id, order_uid, date_created, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status FROM items;
+
+DROP TABLE items;
+DROP TABLE delivery;
+DROP TABLE payment;
+DROP TABLE orders;
+
+CREATE TABLE orders (
+    order_uid VARCHAR NOT NULL,
+    track_number VARCHAR,
+    entry VARCHAR,
+    locale VARCHAR,
+    internal_signature VARCHAR,
+    customer_id VARCHAR,
+    delivery_service VARCHAR,
+    shardkey VARCHAR,
+    sm_id INTEGER,
+    date_created TIMESTAMPTZ NOT NULL,
+    oof_shard VARCHAR,
+    status VARCHAR NOT NULL DEFAULT 'created',
+    PRIMARY KEY (order_uid, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE TABLE delivery (
+    order_uid VARCHAR NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    name VARCHAR,
+    phone VARCHAR,
+    zip VARCHAR,
+    city VARCHAR,
+    address VARCHAR,
+    region VARCHAR,
+    email VARCHAR,
+    PRIMARY KEY (order_uid, date_created),
+    FOREIGN KEY (order_uid, date_created) REFERENCES orders (order_uid, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE TABLE payment (
+    transaction VARCHAR NOT NULL,
+    order_uid VARCHAR NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    request_id VARCHAR,
+    currency VARCHAR,
+    provider VARCHAR,
+    amount INTEGER,
+    payment_dt BIGINT,
+    bank VARCHAR,
+    delivery_cost INTEGER,
+    goods_total INTEGER,
+    custom_fee INTEGER,
+    PRIMARY KEY (transaction, date_created),
+    FOREIGN KEY (order_uid, date_created) REFERENCES orders (order_uid, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE TABLE items (
+    id SERIAL,
+    order_uid VARCHAR NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    chrt_id INTEGER,
+    track_number VARCHAR,
+    price INTEGER,
+    rid VARCHAR,
+    name VARCHAR,
+    sale INTEGER,
+    size VARCHAR,
+    total_price INTEGER,
+    nm_id INTEGER,
+    brand VARCHAR,
+    status INTEGER,
+    search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(brand, '')), 'B')
+    ) STORED,
+    PRIMARY KEY (id, date_created),
+    FOREIGN KEY (order_uid, date_created) REFERENCES orders (order_uid, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE INDEX payment_order_uid_idx ON payment (order_uid, date_created);
+CREATE INDEX items_order_uid_idx ON items (order_uid, date_created);
+CREATE INDEX items_search_vector_idx ON items USING GIN (search_vector);
+CREATE INDEX orders_date_created_uid_idx ON orders (date_created DESC, order_uid DESC);
+CREATE INDEX orders_customer_id_idx ON orders (customer_id, date_created DESC);
+
+CREATE TABLE orders_default PARTITION OF orders DEFAULT;
+CREATE TABLE delivery_default PARTITION OF delivery DEFAULT;
+CREATE TABLE payment_default PARTITION OF payment DEFAULT;
+CREATE TABLE items_default PARTITION OF items DEFAULT;
+
+-- месячные партиции для всех месяцев, по которым уже есть заказы, а также для текущего и трех следующих месяцев
+-- имена партиций совпадают с создаваемыми из Go (db.EnsurePartitions)
+DO $$
+DECLARE
+    month DATE;
+    tbl TEXT;
+BEGIN
+    FOR month IN
+        SELECT DISTINCT date_trunc('month', date_created)::date FROM orders_backup
+        UNION
+        SELECT (date_trunc('month', now() AT TIME ZONE 'UTC') + make_interval(months => n))::date FROM generate_series(0, 3) n
+    LOOP
+        FOREACH tbl IN ARRAY ARRAY['orders', 'delivery', 'payment', 'items'] LOOP
+            EXECUTE format('CREATE TABLE %I PARTITION OF %I FOR VALUES FROM (%L) TO (%L)',
+                format('%s_y%sm%s', tbl, to_char(month, 'YYYY'), to_char(month, 'MM')),
+                tbl,
+                month::text || ' 00:00:00+00',
+                (month + interval '1 month')::date::text || ' 00:00:00+00');
+        END LOOP;
+    END LOOP;
+END $$;
+
+INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, status)
+SELECT order_uid, track_number, entry, locale, internal_signature, customer_id, delivery_service, shardkey, sm_id, date_created AT TIME ZONE 'UTC', oof_shard, status
+FROM orders_backup;
+
+INSERT INTO delivery (order_uid, date_created, name, phone, zip, city, address, region, email)
+SELECT order_uid, date_created AT TIME ZONE 'UTC', name, phone, zip, city, address, region, email
+FROM delivery_backup;
+
+INSERT INTO payment (transaction, order_uid, date_created, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
+SELECT transaction, order_uid, date_created AT TIME ZONE 'UTC', request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
+FROM payment_backup;
+
+INSERT INTO items (id, order_uid, date_created, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status)
+SELECT id, order_uid, date_created AT TIME ZONE 'UTC', chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
+FROM items_backup;
+
+SELECT setval(pg_get_serial_sequence('items', 'id'), COALESCE((SELECT MAX(id) FROM items), 0) + 1, false);
+
+DROP TABLE items_backup;
+DROP TABLE delivery_backup;
+DROP TABLE payment_backup;
+DROP TABLE orders_backup;